@@ -1,23 +1,111 @@
 package cmd
 
 import (
+	"archive/tar"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 
 	"github.com/jodydadescott/prisma-microseg-linter/example"
+	"github.com/jodydadescott/prisma-microseg-linter/prisma/client"
 	"github.com/jodydadescott/prisma-microseg-linter/processor"
+	"github.com/jodydadescott/prisma-microseg-linter/report"
 )
 
+const (
+	outputText    = "text"
+	outputSARIF   = "sarif"
+	outputDOT     = "dot"
+	outputMermaid = "mermaid"
+	outputJSON    = "json"
+	outputYAML    = "yaml"
+)
+
+// configUsage is the usage of the --config flag shared by the commands that load the tree
+const configUsage = "lint config file; defaults to the first " + processor.LintConfigFilename + " found walking up from the injest directory"
+
 var (
-	sanatize, validate, verbose bool
+	sanatize, validate, verbose, dryRun  bool
+	runOutput, graphOutput, bundleOutput string
+	runID, restoreFile, lintConfigFile   string
+	listRuns, excel, force, gitDiff      bool
+	querySource, queryDestination        []string
+	queryPort, graphNamespace            string
+	exportNamespace, pushAPI, tokenFile  string
+	gitPath                              string
+	pushRetries                          int
 )
 
 var rootCmd = &cobra.Command{}
 
+// loadLintConfig loads the lint config from --config if set, otherwise the first one found
+// walking up from dir
+func loadLintConfig(dir string) (*processor.LintConfig, error) {
+
+	if lintConfigFile != "" {
+		return processor.LoadLintConfig(lintConfigFile)
+	}
+
+	return processor.FindLintConfig(dir)
+}
+
+// load loads the lint config and the namespace tree from the injest directory. The lint
+// config is loaded from --config if set.
+func load(dir string) (*processor.LintConfig, *processor.Namespace, error) {
+
+	lintConfig, err := loadLintConfig(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	namespace, err := processor.NewNamespaceWithHierarchy(dir, verbose, lintConfig.NamespaceHierarchy())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return lintConfig, namespace, nil
+}
+
+// loadBundle loads the tree from the injest directory, sanatizes and validates it in memory
+// and returns the bundle. Warnings are logged and errors are returned.
+func loadBundle(dir string) (processor.Bundle, error) {
+
+	lintConfig, namespace, err := load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := namespace.Bundle()
+
+	findings := lintConfig.Apply(namespace.ValidateFindings())
+	findings.Sort()
+
+	for _, x := range findings.Unsuppressed() {
+		if x.Severity != processor.SeverityError {
+			log.Printf("%s: %s [%s]", x.Severity, x.Error(), x.RuleID)
+		}
+	}
+
+	if err := findings.Unsuppressed().WithSeverity(processor.SeverityError).ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "runs the processor",
@@ -30,11 +118,37 @@ var runCmd = &cobra.Command{
 			return fmt.Errorf("Missing injest directory")
 		}
 
+		switch runOutput {
+
+		case outputText:
+
+		case outputSARIF:
+			// Stdout is reserved for the SARIF document
+			log.SetOutput(os.Stderr)
+
+		default:
+			return fmt.Errorf("output %s is not valid; consider %s or %s", runOutput, outputText, outputSARIF)
+		}
+
 		if !sanatize && !validate {
 			return fmt.Errorf("nothing to do; consider --sanatize and/or --validate")
 		}
 
-		processor, err := processor.NewNamespace(args[0], verbose)
+		if dryRun {
+
+			if !sanatize {
+				return fmt.Errorf("--dry-run requires --sanatize")
+			}
+
+			if runOutput == outputSARIF && validate {
+				return fmt.Errorf("--dry-run can not be combined with --output %s", outputSARIF)
+			}
+
+			// Stdout is reserved for the diff
+			log.SetOutput(os.Stderr)
+		}
+
+		lintConfig, namespace, err := load(args[0])
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -42,16 +156,55 @@ var runCmd = &cobra.Command{
 		var errors *multierror.Error
 
 		if sanatize {
-			err = processor.Sanatize()
-			if err != nil {
-				errors = multierror.Append(errors, err)
+
+			if dryRun {
+
+				changed, err := namespace.SanatizeDryRun(os.Stdout)
+				if err != nil {
+					errors = multierror.Append(errors, err)
+				} else if changed > 0 {
+					errors = multierror.Append(errors, fmt.Errorf("%d files are not sanatized", changed))
+				}
+
+			} else {
+
+				err = namespace.Sanatize()
+				if err != nil {
+					errors = multierror.Append(errors, err)
+				}
+
 			}
 		}
 
 		if validate {
-			err = processor.Validate()
-			if err != nil {
-				errors = multierror.Append(errors, err)
+
+			findings := lintConfig.Apply(namespace.ValidateFindings())
+			findings.Sort()
+
+			if runOutput == outputSARIF {
+
+				if err := report.WriteSARIF(os.Stdout, findings); err != nil {
+					errors = multierror.Append(errors, err)
+				} else if findings.HasErrors() {
+					errors = multierror.Append(errors, fmt.Errorf("validation failed with %d errors", len(findings.Unsuppressed().WithSeverity(processor.SeverityError))))
+				}
+
+			} else {
+
+				for _, x := range findings.Unsuppressed() {
+					if x.Severity != processor.SeverityError {
+						log.Printf("%s: %s [%s]", x.Severity, x.Error(), x.RuleID)
+					}
+				}
+
+				for _, x := range findings.Suppressed() {
+					log.Printf("suppressed %s: %s [%s] justification: %s", x.Severity, x.Error(), x.RuleID, x.Justification)
+				}
+
+				if err := findings.Unsuppressed().WithSeverity(processor.SeverityError).ErrorOrNil(); err != nil {
+					errors = multierror.Append(errors, err)
+				}
+
 			}
 		}
 
@@ -63,6 +216,551 @@ var runCmd = &cobra.Command{
 	},
 }
 
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "restores files changed by a sanatize run",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		log.SetOutput(os.Stdout)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) != 1 {
+			return fmt.Errorf("Missing injest directory")
+		}
+
+		if listRuns {
+
+			manifest, err := processor.LoadManifest(args[0])
+			if err != nil {
+				return err
+			}
+
+			for _, run := range manifest.Runs {
+				status := ""
+				if run.InProgress {
+					status = "\tdid not finish"
+				}
+				fmt.Printf("%s\t%s\t%d files%s\n", run.ID, run.Timestamp.Format(time.RFC3339), len(run.Files), status)
+				if verbose {
+					for _, x := range run.Files {
+						fmt.Printf("\t%s\n", x.Path)
+					}
+				}
+			}
+
+			return nil
+		}
+
+		return processor.Restore(args[0], runID, restoreFile, verbose)
+	},
+}
+
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "evaluates whether a source can reach a destination on a protocol port",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Stdout is reserved for the result
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) != 1 {
+			return fmt.Errorf("Missing injest directory")
+		}
+
+		if len(querySource) == 0 || len(queryDestination) == 0 || queryPort == "" {
+			return fmt.Errorf("--from, --to and --port are required")
+		}
+
+		_, namespace, err := load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		result, err := namespace.Query(querySource, queryDestination, queryPort)
+		if err != nil {
+			return err
+		}
+
+		decision := func(name string, x *processor.QueryDecision) {
+			switch {
+			case x.Allowed:
+				fmt.Printf("%s: allow\n", name)
+			case len(x.Matches) > 0:
+				fmt.Printf("%s: deny\n", name)
+			default:
+				fmt.Printf("%s: deny (no matching rule)\n", name)
+			}
+			for _, match := range x.Matches {
+				fmt.Printf("\t%s\n", match.String())
+			}
+		}
+
+		if result.Allowed {
+			fmt.Println("allow")
+		} else {
+			fmt.Println("deny")
+		}
+
+		decision("outgoing", result.Outgoing)
+		decision("incoming", result.Incoming)
+
+		return nil
+	},
+}
+
+var effectiveCmd = &cobra.Command{
+	Use:   "effective",
+	Short: "lists the policies that apply in a namespace",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Stdout is reserved for the result
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) != 2 {
+			return fmt.Errorf("Missing injest directory and/or namespace path")
+		}
+
+		_, namespace, err := load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ns, err := namespace.Find(args[1])
+		if err != nil {
+			return err
+		}
+
+		for _, x := range ns.EffectivePolicies() {
+			if x.Propagated {
+				fmt.Printf("%s\t%s\t%s\tpropagated from %s\n", x.Kind, x.Name, x.Path, x.Namespace)
+			} else {
+				fmt.Printf("%s\t%s\t%s\n", x.Kind, x.Name, x.Path)
+			}
+		}
+
+		return nil
+	},
+}
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "writes the allowed and rejected flows as a DOT or Mermaid graph",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Stdout is reserved for the graph
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) != 1 {
+			return fmt.Errorf("Missing injest directory")
+		}
+
+		var write func(io.Writer, []*processor.Flow) error
+
+		switch graphOutput {
+
+		case outputDOT:
+			write = report.WriteDOT
+
+		case outputMermaid:
+			write = report.WriteMermaid
+
+		default:
+			return fmt.Errorf("output %s is not valid; consider %s or %s", graphOutput, outputDOT, outputMermaid)
+		}
+
+		_, namespace, err := load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ns, err := namespace.Find(graphNamespace)
+		if err != nil {
+			return err
+		}
+
+		return write(os.Stdout, ns.Flows())
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "exports the config in other formats",
+}
+
+var exportMatrixCmd = &cobra.Command{
+	Use:   "matrix",
+	Short: "exports every flow as a CSV matrix",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Stdout is reserved for the matrix
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) != 1 {
+			return fmt.Errorf("Missing injest directory")
+		}
+
+		_, namespace, err := load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return report.WriteMatrix(os.Stdout, namespace.Flows(), args[0], excel)
+	},
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "sanatizes and validates in memory and writes the api/import payload for each namespace",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Stdout is reserved for the bundle
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) != 1 {
+			return fmt.Errorf("Missing injest directory")
+		}
+
+		if bundleOutput != outputJSON && bundleOutput != outputYAML {
+			return fmt.Errorf("output %s is not valid; consider %s or %s", bundleOutput, outputJSON, outputYAML)
+		}
+
+		bundle, err := loadBundle(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var data []byte
+
+		if bundleOutput == outputYAML {
+			data, err = yaml.Marshal(bundle)
+		} else {
+			data, err = json.MarshalIndent(bundle, "", "  ")
+			data = append(data, '\n')
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(data)
+		return err
+	},
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "sanatizes and validates in memory and posts each namespace's configs to the import API",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		log.SetOutput(os.Stdout)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) != 1 {
+			return fmt.Errorf("Missing injest directory")
+		}
+
+		config := client.NewConfig()
+		config.API = pushAPI
+		config.Retries = pushRetries
+		config.DryRun = dryRun
+
+		if config.API == "" {
+			config.API = os.Getenv(client.APIEnv)
+		}
+
+		if !dryRun {
+			token, err := client.LoadToken(tokenFile)
+			if err != nil {
+				return err
+			}
+			config.Token = token
+		}
+
+		c, err := client.NewClient(config)
+		if err != nil {
+			return err
+		}
+
+		bundle, err := loadBundle(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var namespaces []string
+		for ns := range bundle {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Strings(namespaces)
+
+		for _, ns := range namespaces {
+			for _, x := range bundle[ns] {
+				if err := c.Import(context.Background(), "/"+ns, x); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+
+		return nil
+	},
+}
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "compares the tree with exported snapshots; each snapshot is [namespace=]file where the namespace is not needed for a bundle",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		log.SetOutput(os.Stdout)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) < 2 {
+			return fmt.Errorf("Missing injest directory and/or snapshot")
+		}
+
+		snapshot := make(processor.Bundle)
+
+		for _, arg := range args[1:] {
+
+			ns, filename := "", arg
+			if i := strings.Index(arg, "="); i >= 0 {
+				ns, filename = arg[:i], arg[i+1:]
+			}
+
+			f, err := os.Open(filename)
+			if err != nil {
+				return err
+			}
+
+			bundle, err := processor.ReadExport(f, ns)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("snapshot %s : %w", filename, err)
+			}
+
+			for k, v := range bundle {
+				snapshot[k] = append(snapshot[k], v...)
+			}
+		}
+
+		_, namespace, err := load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		drift := namespace.Bundle().Drift(snapshot)
+
+		for _, x := range drift {
+			fmt.Println(x.String())
+			for _, field := range x.Fields {
+				fmt.Printf("\t%s\n", field.String())
+			}
+		}
+
+		if len(drift) > 0 {
+			log.Fatalf("%d objects have drifted", len(drift))
+		}
+
+		return nil
+	},
+}
+
+// gitCheckout extracts the path at the git revision of the repository in the working
+// directory into a temporary directory. The directory of the path and a function that removes
+// the temporary directory are returned.
+func gitCheckout(rev, path string) (string, func(), error) {
+
+	dir, err := ioutil.TempDir("", "prisma-microseg-linter-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	cleanup := func() { os.RemoveAll(dir) }
+
+	git := exec.Command("git", "archive", "--format=tar", rev, "--", path)
+	git.Stderr = os.Stderr
+
+	stdout, err := git.StdoutPipe()
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	if err := git.Start(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	extract := func() error {
+
+		r := tar.NewReader(stdout)
+
+		for {
+
+			header, err := r.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			name := filepath.Join(dir, filepath.FromSlash(header.Name))
+			if !strings.HasPrefix(name, dir+string(filepath.Separator)) {
+				return fmt.Errorf("git archive entry %s is outside of the directory", header.Name)
+			}
+
+			switch header.Typeflag {
+
+			case tar.TypeDir:
+				if err := os.MkdirAll(name, os.ModePerm); err != nil {
+					return err
+				}
+
+			case tar.TypeReg:
+				if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+					return err
+				}
+				f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(f, r)
+				f.Close()
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	err = extract()
+
+	if waitErr := git.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("git archive %s failed : %w", rev, waitErr)
+	}
+
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(path)), cleanup, nil
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "reports the semantic changes between two directories, or two git revisions with --git",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Stdout is reserved for the changes
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) != 2 {
+			return fmt.Errorf("Missing old and/or new directory or revision")
+		}
+
+		var from, to *processor.Namespace
+		var err error
+
+		if gitDiff {
+
+			// The checkouts are in temporary directories so the lint config is looked up
+			// from the injest directory in the working tree and used for both revisions
+			lintConfig, err := loadLintConfig(gitPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			var namespaces []*processor.Namespace
+
+			// log.Fatal skips deferred calls so the checkouts are removed before it is called
+			var cleanups []func()
+			cleanup := func() {
+				for _, x := range cleanups {
+					x()
+				}
+			}
+			defer cleanup()
+
+			for _, rev := range args {
+
+				dir, remove, err := gitCheckout(rev, gitPath)
+				if err != nil {
+					return err
+				}
+				cleanups = append(cleanups, remove)
+
+				namespace, err := processor.NewNamespaceWithHierarchy(dir, verbose, lintConfig.NamespaceHierarchy())
+				if err != nil {
+					cleanup()
+					log.Fatal(err)
+				}
+
+				namespaces = append(namespaces, namespace)
+			}
+
+			from, to = namespaces[0], namespaces[1]
+
+		} else {
+
+			if _, from, err = load(args[0]); err != nil {
+				log.Fatal(err)
+			}
+
+			if _, to, err = load(args[1]); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		namespace := ""
+
+		for _, x := range processor.SemanticDiff(from, to) {
+			if x.Namespace != namespace {
+				namespace = x.Namespace
+				fmt.Printf("namespace %s\n", namespace)
+			}
+			fmt.Printf("\t%s\n", x.String())
+		}
+
+		return nil
+	},
+}
+
+var ingestExportCmd = &cobra.Command{
+	Use:   "ingest-export",
+	Short: "writes the configs of a Prisma export into the directory tree",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		log.SetOutput(os.Stdout)
+		log.SetFlags(log.Lshortfile)
+
+		if len(args) != 2 {
+			return fmt.Errorf("Missing export file and/or injest directory")
+		}
+
+		lintConfig, err := loadLintConfig(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err := processor.IngestExport(args[1], exportNamespace, f, lintConfig.NamespaceHierarchy(), force); err != nil {
+			log.Fatal(err)
+		}
+
+		return nil
+	},
+}
+
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "generates example config",
@@ -82,6 +780,46 @@ func Execute() error {
 func init() {
 	runCmd.PersistentFlags().BoolVar(&sanatize, "sanatize", false, "sanatizes config")
 	runCmd.PersistentFlags().BoolVar(&validate, "validate", false, "validates config")
+	runCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "shows the changes sanatize would make without writing them")
+	runCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	runCmd.PersistentFlags().StringVarP(&runOutput, "output", "o", outputText, "output format for validation (text or sarif)")
 	runCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
-	rootCmd.AddCommand(runCmd, configCmd)
+	restoreCmd.PersistentFlags().StringVar(&runID, "run", "", "ID of the run to restore; defaults to the latest run")
+	restoreCmd.PersistentFlags().StringVar(&restoreFile, "file", "", "restore only this file (relative to the injest directory)")
+	restoreCmd.PersistentFlags().BoolVar(&listRuns, "list", false, "lists the recorded runs")
+	restoreCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	queryCmd.PersistentFlags().StringSliceVar(&querySource, "from", nil, "tags of the source workload (comma separated or repeated)")
+	queryCmd.PersistentFlags().StringSliceVar(&queryDestination, "to", nil, "tags of the destination workload (comma separated or repeated)")
+	queryCmd.PersistentFlags().StringVar(&queryPort, "port", "", "protocol port such as tcp/5432")
+	queryCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	queryCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	effectiveCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	effectiveCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	graphCmd.PersistentFlags().StringVarP(&graphOutput, "output", "o", outputDOT, "output format (dot or mermaid)")
+	graphCmd.PersistentFlags().StringVar(&graphNamespace, "namespace", "", "only include rules defined in this namespace (for example a tenant, cloud or group) and below")
+	graphCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	graphCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	exportMatrixCmd.PersistentFlags().BoolVar(&excel, "excel", false, "prefix cells a spreadsheet would interpret as a formula with a single quote")
+	exportMatrixCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	exportMatrixCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	exportCmd.AddCommand(exportMatrixCmd)
+	bundleCmd.PersistentFlags().StringVarP(&bundleOutput, "output", "o", outputJSON, "output format (json or yaml)")
+	bundleCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	bundleCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	ingestExportCmd.PersistentFlags().StringVar(&exportNamespace, "namespace", "", "Prisma namespace the configs live in, for example /841735782980352000/cloud1/cluster1/app; not needed for a bundle")
+	ingestExportCmd.PersistentFlags().BoolVar(&force, "force", false, "replace existing files")
+	ingestExportCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	pushCmd.PersistentFlags().StringVar(&pushAPI, "api", "", "Prisma API URL; defaults to $"+client.APIEnv)
+	pushCmd.PersistentFlags().StringVar(&tokenFile, "token-file", "", "file holding the API token; defaults to $"+client.TokenEnv)
+	pushCmd.PersistentFlags().IntVar(&pushRetries, "retries", 3, "number of times a failed request is retried")
+	pushCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "logs the requests without sending them")
+	pushCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	pushCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	driftCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	driftCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	diffCmd.PersistentFlags().BoolVar(&gitDiff, "git", false, "the arguments are git revisions of the repository in the working directory")
+	diffCmd.PersistentFlags().StringVar(&gitPath, "path", ".", "with --git, the injest directory within the repository")
+	diffCmd.PersistentFlags().StringVar(&lintConfigFile, "config", "", configUsage)
+	diffCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose logging")
+	rootCmd.AddCommand(runCmd, restoreCmd, queryCmd, effectiveCmd, graphCmd, exportCmd, bundleCmd, pushCmd, driftCmd, diffCmd, ingestExportCmd, configCmd)
 }
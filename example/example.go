@@ -251,7 +251,7 @@ correct these tags.
 
 Note: When calling sanatize and validate, sanatize will run first and will fix issues
 such as labels. Hence if you wish to see these errors you will need to run validate
-without the sanatize option. If you have already ran sanatize run the restore.sh script
+without the sanatize option. If you have already ran sanatize run the restore command
 and then run with the validate option only.
 `
 
@@ -309,7 +309,7 @@ will not be able to correct the non-existent cloud issue.
 
 Note: When calling sanatize and validate, sanatize will run first and will fix issues
 such as labels. Hence if you wish to see these errors you will need to run validate
-without the sanatize option. If you have already ran sanatize run the restore.sh script
+without the sanatize option. If you have already ran sanatize run the restore command
 and then run with the validate option only.
 `
 
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+const (
+	// TokenEnv is the environment variable the token is read from if no token file is set
+	TokenEnv = "PRISMA_TOKEN"
+	// APIEnv is the environment variable the API URL is read from if none is set
+	APIEnv = "PRISMA_API"
+	// ImportPath is the path of the import endpoint relative to the API URL
+	ImportPath = "/import"
+	// NamespaceHeader is the header that holds the namespace a request applies to
+	NamespaceHeader = "X-Namespace"
+
+	defaultRetries   = 3
+	defaultRetryWait = time.Second
+	maxErrorBody     = 1024
+)
+
+// Config is the client configuration. API is the base URL of the Prisma API. If HTTPClient is
+// nil http.DefaultClient is used; it may be replaced, for example to use an httptest server.
+// A request that fails with a network error, 429 or a 5xx status is retried up to Retries
+// times waiting RetryWait multiplied by the attempt between each. If DryRun is true requests
+// are logged and not sent.
+type Config struct {
+	API        string
+	Token      string
+	HTTPClient *http.Client
+	Retries    int
+	RetryWait  time.Duration
+	DryRun     bool
+}
+
+// NewConfig returns a Config with the default retries
+func NewConfig() *Config {
+	return &Config{
+		Retries:   defaultRetries,
+		RetryWait: defaultRetryWait,
+	}
+}
+
+// LoadToken returns the token from the file or, if file is empty, from the TokenEnv
+// environment variable. Surrounding whitespace is removed.
+func LoadToken(file string) (string, error) {
+
+	var token string
+
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		token = string(b)
+	} else {
+		token = os.Getenv(TokenEnv)
+	}
+
+	token = strings.TrimSpace(token)
+
+	if token == "" {
+		if file != "" {
+			return "", fmt.Errorf("token file %s is empty", file)
+		}
+		return "", fmt.Errorf("token is required; set %s or use a token file", TokenEnv)
+	}
+
+	return token, nil
+}
+
+// Client posts configs to the Prisma import endpoint
+type Client struct {
+	config *Config
+}
+
+// NewClient returns a new Client. The API URL is required and unless DryRun is set so is the
+// token. Retries may not be negative.
+func NewClient(config *Config) (*Client, error) {
+
+	if config == nil {
+		return nil, fmt.Errorf("config is required")
+	}
+
+	if config.API == "" {
+		return nil, fmt.Errorf("API is required")
+	}
+
+	if config.Token == "" && !config.DryRun {
+		return nil, fmt.Errorf("token is required")
+	}
+
+	if config.Retries < 0 {
+		return nil, fmt.Errorf("retries must not be negative")
+	}
+
+	c := *config
+
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+
+	c.API = strings.TrimSuffix(c.API, "/")
+
+	return &Client{config: &c}, nil
+}
+
+// Import posts the config to the import endpoint for the namespace, for example
+// /841735782980352000/cloud1/cluster1/app
+func (t *Client) Import(ctx context.Context, namespace string, config *prisma.OuterConfig) error {
+
+	body, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	url := t.config.API + ImportPath
+
+	label := ""
+	if config.Data != nil {
+		label = config.Data.Label
+	}
+
+	if t.config.DryRun {
+		log.Printf("dry run: POST %s namespace %s label \"%s\" (%d bytes)", url, namespace, label, len(body))
+		return nil
+	}
+
+	var lastErr error
+
+	for attempt := 0; attempt <= t.config.Retries; attempt++ {
+
+		if attempt > 0 {
+			log.Printf("retrying import of label \"%s\" to namespace %s (attempt %d) : %s", label, namespace, attempt+1, lastErr)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(t.config.RetryWait * time.Duration(attempt)):
+			}
+		}
+
+		retry, err := t.post(ctx, url, namespace, body)
+		if err == nil {
+			log.Printf("imported label \"%s\" to namespace %s", label, namespace)
+			return nil
+		}
+
+		if !retry {
+			return err
+		}
+
+		lastErr = err
+	}
+
+	return fmt.Errorf("import of label \"%s\" to namespace %s failed after %d attempts : %w", label, namespace, t.config.Retries+1, lastErr)
+}
+
+// post sends a single request. It returns true if the request may be retried.
+func (t *Client) post(ctx context.Context, url, namespace string, body []byte) (bool, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.config.Token)
+	req.Header.Set(NamespaceHeader, namespace)
+
+	resp, err := t.config.HTTPClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	err = fmt.Errorf("import to namespace %s returned %s : %s", namespace, resp.Status, strings.TrimSpace(string(b)))
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// recorder is an import endpoint that records each request and replies with the next status
+type recorder struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (t *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	t.requests = append(t.requests, r)
+	t.bodies = append(t.bodies, body)
+
+	status := http.StatusOK
+	if len(t.statuses) > 0 {
+		status = t.statuses[0]
+		t.statuses = t.statuses[1:]
+	}
+
+	w.WriteHeader(status)
+}
+
+func (t *recorder) count() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.requests)
+}
+
+func newTestClient(t *testing.T, url string, dryRun bool) *Client {
+
+	config := NewConfig()
+	config.API = url + "/"
+	config.Token = "secret"
+	config.Retries = 2
+	config.RetryWait = time.Millisecond
+	config.DryRun = dryRun
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func testConfig() *prisma.OuterConfig {
+	return &prisma.OuterConfig{Data: &prisma.Config{Label: "app"}}
+}
+
+func TestImportHeaders(t *testing.T) {
+
+	r := &recorder{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	if err := newTestClient(t, server.URL, false).Import(context.Background(), "/tenant/cloud", testConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.count() != 1 {
+		t.Fatalf("expected 1 request, got %d", r.count())
+	}
+
+	req := r.requests[0]
+
+	if req.Method != http.MethodPost {
+		t.Errorf("expected method %s, got %s", http.MethodPost, req.Method)
+	}
+
+	if req.URL.Path != ImportPath {
+		t.Errorf("expected path %s, got %s", ImportPath, req.URL.Path)
+	}
+
+	if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("expected Authorization \"Bearer secret\", got \"%s\"", got)
+	}
+
+	if got := req.Header.Get(NamespaceHeader); got != "/tenant/cloud" {
+		t.Errorf("expected %s \"/tenant/cloud\", got \"%s\"", NamespaceHeader, got)
+	}
+
+	if got := req.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected Content-Type \"application/json\", got \"%s\"", got)
+	}
+
+	config := &prisma.OuterConfig{}
+	if err := json.Unmarshal(r.bodies[0], config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Data == nil || config.Data.Label != "app" {
+		t.Errorf("expected label \"app\" in body, got %s", r.bodies[0])
+	}
+}
+
+func TestImportRetries(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		fail     bool
+	}{
+		{"ok", []int{http.StatusOK}, 1, false},
+		{"server error retried", []int{http.StatusInternalServerError, http.StatusOK}, 2, false},
+		{"too many requests retried", []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}, 3, false},
+		{"retries exhausted", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, 3, true},
+		{"bad request not retried", []int{http.StatusBadRequest, http.StatusOK}, 1, true},
+		{"unauthorized not retried", []int{http.StatusUnauthorized, http.StatusOK}, 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			r := &recorder{statuses: test.statuses}
+			server := httptest.NewServer(r)
+			defer server.Close()
+
+			err := newTestClient(t, server.URL, false).Import(context.Background(), "/tenant", testConfig())
+
+			if test.fail && err == nil {
+				t.Error("expected an error")
+			}
+
+			if !test.fail && err != nil {
+				t.Errorf("unexpected error : %s", err)
+			}
+
+			if r.count() != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, r.count())
+			}
+		})
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+
+	r := &recorder{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	if err := newTestClient(t, server.URL, true).Import(context.Background(), "/tenant", testConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.count() != 0 {
+		t.Errorf("expected no requests, got %d", r.count())
+	}
+}
+
+func TestNewClient(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		config *Config
+		fail   bool
+	}{
+		{"nil", nil, true},
+		{"no api", &Config{Token: "secret"}, true},
+		{"no token", &Config{API: "http://localhost"}, true},
+		{"no token dry run", &Config{API: "http://localhost", DryRun: true}, false},
+		{"negative retries", &Config{API: "http://localhost", Token: "secret", Retries: -1}, true},
+		{"valid", &Config{API: "http://localhost", Token: "secret"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewClient(test.config)
+			if test.fail && err == nil {
+				t.Error("expected an error")
+			}
+			if !test.fail && err != nil {
+				t.Errorf("unexpected error : %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package prisma
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ProtocolAny matches every protocol
+	ProtocolAny = "any"
+	// ProtocolTCP is TCP
+	ProtocolTCP = "tcp"
+	// ProtocolUDP is UDP
+	ProtocolUDP = "udp"
+	// ProtocolICMP is ICMP
+	ProtocolICMP = "icmp"
+	// ProtocolICMP6 is ICMP for IPv6
+	ProtocolICMP6 = "icmp6"
+
+	// MinPort is the lowest valid port
+	MinPort = 1
+	// MaxPort is the highest valid port
+	MaxPort = 65535
+)
+
+var (
+	// ErrProtocolPortSyntax is returned (wrapped) when a protocol port is malformed
+	ErrProtocolPortSyntax = errors.New("malformed protocol port")
+	// ErrProtocolPortRange is returned (wrapped) when a port, protocol number or ICMP type or
+	// code is out of range
+	ErrProtocolPortRange = errors.New("protocol port out of range")
+)
+
+// protocolNumbers maps the IANA protocol numbers to the names used by Prisma
+var protocolNumbers = map[int]string{
+	1:  ProtocolICMP,
+	6:  ProtocolTCP,
+	17: ProtocolUDP,
+	58: ProtocolICMP6,
+}
+
+// ProtocolPort is a parsed entry of Rule.ProtocolPorts. The following forms are supported;
+// "any", "tcp", "tcp/80", "udp/1000:2000", "icmp", "icmp/8", "icmp/8/0" and a protocol
+// number such as "47". TCP and UDP without a port match every port. ICMP without a type or
+// code matches every type or code.
+type ProtocolPort struct {
+	Protocol string `json:"protocol" yaml:"protocol"`
+	FromPort int    `json:"fromPort,omitempty" yaml:"fromPort,omitempty"`
+	ToPort   int    `json:"toPort,omitempty" yaml:"toPort,omitempty"`
+	ICMPType *int   `json:"icmpType,omitempty" yaml:"icmpType,omitempty"`
+	ICMPCode *int   `json:"icmpCode,omitempty" yaml:"icmpCode,omitempty"`
+}
+
+// ParseProtocolPort parses a protocol port such as "tcp/80". If the string is not valid an error
+// wrapping ErrProtocolPortSyntax or ErrProtocolPortRange is returned.
+func ParseProtocolPort(s string) (*ProtocolPort, error) {
+
+	parts := strings.Split(strings.ToLower(s), "/")
+
+	protocol := parts[0]
+	if protocol == "" || protocol != strings.TrimSpace(protocol) {
+		return nil, fmt.Errorf("%w: %q", ErrProtocolPortSyntax, s)
+	}
+
+	if n, err := strconv.Atoi(protocol); err == nil {
+		if n < 0 || n > 255 {
+			return nil, fmt.Errorf("%w: protocol number %d in %q", ErrProtocolPortRange, n, s)
+		}
+		if name, ok := protocolNumbers[n]; ok {
+			protocol = name
+		}
+	}
+
+	t := &ProtocolPort{Protocol: protocol}
+
+	switch protocol {
+
+	case ProtocolAny:
+		if len(parts) > 1 {
+			return nil, fmt.Errorf("%w: %s does not take a port in %q", ErrProtocolPortSyntax, protocol, s)
+		}
+
+	case ProtocolTCP, ProtocolUDP:
+
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("%w: %q", ErrProtocolPortSyntax, s)
+		}
+
+		t.FromPort, t.ToPort = MinPort, MaxPort
+
+		if len(parts) == 2 {
+
+			ports := strings.Split(parts[1], ":")
+			if len(ports) > 2 {
+				return nil, fmt.Errorf("%w: port range in %q", ErrProtocolPortSyntax, s)
+			}
+
+			from, err := parseProtocolPortNumber(ports[0], MinPort, MaxPort, s)
+			if err != nil {
+				return nil, err
+			}
+
+			to := from
+			if len(ports) == 2 {
+				to, err = parseProtocolPortNumber(ports[1], MinPort, MaxPort, s)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if from > to {
+				return nil, fmt.Errorf("%w: port range %d:%d is reversed in %q", ErrProtocolPortRange, from, to, s)
+			}
+
+			t.FromPort, t.ToPort = from, to
+		}
+
+	case ProtocolICMP, ProtocolICMP6:
+
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("%w: %q", ErrProtocolPortSyntax, s)
+		}
+
+		if len(parts) > 1 {
+			v, err := parseProtocolPortNumber(parts[1], 0, 255, s)
+			if err != nil {
+				return nil, err
+			}
+			t.ICMPType = &v
+		}
+
+		if len(parts) > 2 {
+			v, err := parseProtocolPortNumber(parts[2], 0, 255, s)
+			if err != nil {
+				return nil, err
+			}
+			t.ICMPCode = &v
+		}
+
+	default:
+
+		if _, err := strconv.Atoi(protocol); err != nil {
+			return nil, fmt.Errorf("%w: unknown protocol %s in %q", ErrProtocolPortSyntax, protocol, s)
+		}
+
+		if len(parts) > 1 {
+			return nil, fmt.Errorf("%w: protocol %s does not take a port in %q", ErrProtocolPortSyntax, protocol, s)
+		}
+	}
+
+	return t, nil
+}
+
+// parseProtocolPortNumber parses a port, ICMP type or ICMP code and verifies it is within min and max
+func parseProtocolPortNumber(v string, min, max int, s string) (int, error) {
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a number in %q", ErrProtocolPortSyntax, v, s)
+	}
+
+	if n < min || n > max {
+		return 0, fmt.Errorf("%w: %d is not between %d and %d in %q", ErrProtocolPortRange, n, min, max, s)
+	}
+
+	return n, nil
+}
+
+// ParseProtocolPorts parses each of the protocol ports. An empty list is returned as a single
+// protocol port that matches any protocol.
+func ParseProtocolPorts(s []string) ([]*ProtocolPort, error) {
+
+	if len(s) == 0 {
+		return []*ProtocolPort{{Protocol: ProtocolAny}}, nil
+	}
+
+	var result []*ProtocolPort
+
+	for _, x := range s {
+		protocolPort, err := ParseProtocolPort(x)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, protocolPort)
+	}
+
+	return result, nil
+}
+
+// ParsedProtocolPorts returns the parsed ProtocolPorts of the rule. See ParseProtocolPorts.
+func (t *Rule) ParsedProtocolPorts() ([]*ProtocolPort, error) {
+	return ParseProtocolPorts(t.ProtocolPorts)
+}
+
+// Overlaps returns true if there is traffic matched by both t and other
+func (t *ProtocolPort) Overlaps(other *ProtocolPort) bool {
+
+	if t.Protocol == ProtocolAny || other.Protocol == ProtocolAny {
+		return true
+	}
+
+	if t.Protocol != other.Protocol {
+		return false
+	}
+
+	switch t.Protocol {
+
+	case ProtocolTCP, ProtocolUDP:
+		return t.FromPort <= other.ToPort && other.FromPort <= t.ToPort
+
+	case ProtocolICMP, ProtocolICMP6:
+		return optionalIntOverlaps(t.ICMPType, other.ICMPType) && optionalIntOverlaps(t.ICMPCode, other.ICMPCode)
+	}
+
+	return true
+}
+
+// Contains returns true if all of the traffic matched by other is also matched by t
+func (t *ProtocolPort) Contains(other *ProtocolPort) bool {
+
+	if t.Protocol == ProtocolAny {
+		return true
+	}
+
+	if t.Protocol != other.Protocol {
+		return false
+	}
+
+	switch t.Protocol {
+
+	case ProtocolTCP, ProtocolUDP:
+		return t.FromPort <= other.FromPort && other.ToPort <= t.ToPort
+
+	case ProtocolICMP, ProtocolICMP6:
+		return optionalIntContains(t.ICMPType, other.ICMPType) && optionalIntContains(t.ICMPCode, other.ICMPCode)
+	}
+
+	return true
+}
+
+// optionalIntOverlaps returns true if a and b match a common value. Nil matches every value.
+func optionalIntOverlaps(a, b *int) bool {
+	return a == nil || b == nil || *a == *b
+}
+
+// optionalIntContains returns true if a matches every value matched by b. Nil matches every value.
+func optionalIntContains(a, b *int) bool {
+	return a == nil || (b != nil && *a == *b)
+}
+
+func (t *ProtocolPort) String() string {
+
+	switch t.Protocol {
+
+	case ProtocolTCP, ProtocolUDP:
+		if t.FromPort == MinPort && t.ToPort == MaxPort {
+			return t.Protocol
+		}
+		if t.FromPort == t.ToPort {
+			return fmt.Sprintf("%s/%d", t.Protocol, t.FromPort)
+		}
+		return fmt.Sprintf("%s/%d:%d", t.Protocol, t.FromPort, t.ToPort)
+
+	case ProtocolICMP, ProtocolICMP6:
+		s := t.Protocol
+		if t.ICMPType != nil {
+			s = fmt.Sprintf("%s/%d", s, *t.ICMPType)
+			if t.ICMPCode != nil {
+				s = fmt.Sprintf("%s/%d", s, *t.ICMPCode)
+			}
+		}
+		return s
+	}
+
+	return t.Protocol
+}
@@ -0,0 +1,169 @@
+package prisma
+
+import (
+	"errors"
+	"testing"
+)
+
+// protocolPort parses a protocol port
+func protocolPort(t *testing.T, s string) *ProtocolPort {
+
+	p, err := ParseProtocolPort(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestParseProtocolPort(t *testing.T) {
+
+	tests := []struct {
+		s    string
+		want string
+		err  error
+		from int
+		to   int
+	}{
+		{s: "any", want: "any"},
+		{s: "ANY", want: "any"},
+		{s: "tcp", want: "tcp", from: MinPort, to: MaxPort},
+		{s: "tcp/80", want: "tcp/80", from: 80, to: 80},
+		{s: "udp/1000:2000", want: "udp/1000:2000", from: 1000, to: 2000},
+		{s: "tcp/1:65535", want: "tcp", from: MinPort, to: MaxPort},
+		{s: "6/443", want: "tcp/443", from: 443, to: 443},
+		{s: "17", want: "udp", from: MinPort, to: MaxPort},
+		{s: "icmp", want: "icmp"},
+		{s: "icmp/8", want: "icmp/8"},
+		{s: "icmp/8/0", want: "icmp/8/0"},
+		{s: "58/128", want: "icmp6/128"},
+		{s: "47", want: "47"},
+		{s: "", err: ErrProtocolPortSyntax},
+		{s: " tcp", err: ErrProtocolPortSyntax},
+		{s: "sctp", err: ErrProtocolPortSyntax},
+		{s: "any/80", err: ErrProtocolPortSyntax},
+		{s: "47/80", err: ErrProtocolPortSyntax},
+		{s: "tcp/80/90", err: ErrProtocolPortSyntax},
+		{s: "tcp/1:2:3", err: ErrProtocolPortSyntax},
+		{s: "tcp/http", err: ErrProtocolPortSyntax},
+		{s: "icmp/8/0/1", err: ErrProtocolPortSyntax},
+		{s: "tcp/0", err: ErrProtocolPortRange},
+		{s: "tcp/65536", err: ErrProtocolPortRange},
+		{s: "tcp/2000:1000", err: ErrProtocolPortRange},
+		{s: "icmp/256", err: ErrProtocolPortRange},
+		{s: "256", err: ErrProtocolPortRange},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+
+			p, err := ParseProtocolPort(test.s)
+
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Errorf("expected %v, got %v", test.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p.String() != test.want {
+				t.Errorf("expected %s, got %s", test.want, p.String())
+			}
+
+			if p.FromPort != test.from || p.ToPort != test.to {
+				t.Errorf("expected ports %d:%d, got %d:%d", test.from, test.to, p.FromPort, p.ToPort)
+			}
+		})
+	}
+}
+
+func TestParseProtocolPorts(t *testing.T) {
+
+	p, err := ParseProtocolPorts(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p) != 1 || p[0].Protocol != ProtocolAny {
+		t.Errorf("expected any, got %v", p)
+	}
+
+	if _, err := ParseProtocolPorts([]string{"tcp/80", "tcp/0"}); !errors.Is(err, ErrProtocolPortRange) {
+		t.Errorf("expected ErrProtocolPortRange, got %v", err)
+	}
+}
+
+func TestProtocolPortOverlaps(t *testing.T) {
+
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"any", "tcp/80", true},
+		{"udp/53", "any", true},
+		{"tcp", "tcp/80", true},
+		{"tcp/80", "tcp/80", true},
+		{"tcp/80", "tcp/443", false},
+		{"tcp/80:90", "tcp/90:100", true},
+		{"tcp/80:89", "tcp/90:100", false},
+		{"tcp/80", "udp/80", false},
+		{"icmp", "icmp/8/0", true},
+		{"icmp/8", "icmp/8/0", true},
+		{"icmp/8", "icmp/0", false},
+		{"icmp/8/0", "icmp/8/1", false},
+		{"icmp/8", "icmp6/8", false},
+		{"47", "47", true},
+		{"47", "50", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" "+test.b, func(t *testing.T) {
+
+			a, b := protocolPort(t, test.a), protocolPort(t, test.b)
+
+			if got := a.Overlaps(b); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+
+			if got := b.Overlaps(a); got != test.want {
+				t.Errorf("expected %t reversed, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestProtocolPortContains(t *testing.T) {
+
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"any", "tcp/80", true},
+		{"any", "any", true},
+		{"tcp/80", "any", false},
+		{"tcp", "tcp/80", true},
+		{"tcp/80", "tcp", false},
+		{"tcp/80:90", "tcp/85:90", true},
+		{"tcp/80:90", "tcp/85:95", false},
+		{"tcp/80", "udp/80", false},
+		{"icmp", "icmp/8/0", true},
+		{"icmp/8", "icmp/8/0", true},
+		{"icmp/8/0", "icmp/8", false},
+		{"icmp/8", "icmp", false},
+		{"icmp/8", "icmp/0", false},
+		{"47", "47", true},
+		{"47", "50", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" "+test.b, func(t *testing.T) {
+			if got := protocolPort(t, test.a).Contains(protocolPort(t, test.b)); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
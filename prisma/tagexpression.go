@@ -0,0 +1,316 @@
+package prisma
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TagWildcard is the value that matches any value of a key
+const TagWildcard = "*"
+
+// ErrTagSyntax is returned (wrapped) when a tag is malformed
+var ErrTagSyntax = errors.New("malformed tag")
+
+// Tag is a parsed tag of a subject or object. The following forms are supported; "key=value",
+// "key=*" which matches any value of the key, "key!=value" which matches workloads that do not
+// have the value and "key!=*" which matches workloads that do not have the key.
+type Tag struct {
+	Key     string `json:"key" yaml:"key"`
+	Value   string `json:"value" yaml:"value"`
+	Negated bool   `json:"negated,omitempty" yaml:"negated,omitempty"`
+}
+
+// ParseTag parses a tag such as "app=web". If the tag is not valid an error wrapping
+// ErrTagSyntax is returned.
+func ParseTag(s string) (*Tag, error) {
+
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %q does not have a '='", ErrTagSyntax, s)
+	}
+
+	t := &Tag{Key: s[:i], Value: s[i+1:]}
+
+	if strings.HasSuffix(t.Key, "!") {
+		t.Key = strings.TrimSuffix(t.Key, "!")
+		t.Negated = true
+	}
+
+	if t.Key == "" {
+		return nil, fmt.Errorf("%w: %q does not have a key", ErrTagSyntax, s)
+	}
+
+	if t.Value == "" {
+		return nil, fmt.Errorf("%w: %q does not have a value", ErrTagSyntax, s)
+	}
+
+	return t, nil
+}
+
+// IsWildcard returns true if the tag matches any value of the key
+func (t *Tag) IsWildcard() bool {
+	return t.Value == TagWildcard
+}
+
+// Matches returns true if the workload tags match the tag
+func (t *Tag) Matches(tags TagSet) bool {
+
+	var present bool
+	if t.IsWildcard() {
+		present = len(tags[t.Key]) > 0
+	} else {
+		present = tags[t.Key][t.Value]
+	}
+
+	return present != t.Negated
+}
+
+func (t *Tag) String() string {
+	if t.Negated {
+		return t.Key + "!=" + t.Value
+	}
+	return t.Key + "=" + t.Value
+}
+
+// TagSet is the set of tags carried by a workload. It maps each key to its values.
+type TagSet map[string]map[string]bool
+
+// NewTagSet returns the TagSet for the tags. Tags without a '=' are ignored.
+func NewTagSet(tags []string) TagSet {
+
+	t := make(TagSet)
+
+	for _, tag := range tags {
+		i := strings.Index(tag, "=")
+		if i < 0 {
+			continue
+		}
+		t.Add(tag[:i], tag[i+1:])
+	}
+
+	return t
+}
+
+// Add adds the tag with the key and value
+func (t TagSet) Add(key, value string) {
+	if t[key] == nil {
+		t[key] = make(map[string]bool)
+	}
+	t[key][value] = true
+}
+
+// TagClause is a list of tags that are ANDed; it is a single entry of a Subject or Object
+type TagClause []*Tag
+
+// ParseTagClause parses each of the tags of the clause
+func ParseTagClause(s []string) (TagClause, error) {
+
+	var t TagClause
+
+	for _, x := range s {
+		tag, err := ParseTag(x)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, tag)
+	}
+
+	return t, nil
+}
+
+// Matches returns true if the workload tags match every tag of the clause. An empty clause
+// does not match anything.
+func (t TagClause) Matches(tags TagSet) bool {
+
+	if len(t) == 0 {
+		return false
+	}
+
+	for _, x := range t {
+		if !x.Matches(tags) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// satisfiable returns true if some workload can match every tag of the clause. Keys for which
+// exclusive returns true can only have one value; exclusive may be nil.
+func (t TagClause) satisfiable(exclusive func(key string) bool) bool {
+
+	if len(t) == 0 {
+		return false
+	}
+
+	values := make(map[string]string)
+
+	for _, x := range t {
+		for _, y := range t {
+			if x.Key != y.Key || x.Negated == y.Negated {
+				continue
+			}
+			positive, negative := x, y
+			if x.Negated {
+				positive, negative = y, x
+			}
+			if negative.IsWildcard() || negative.Value == positive.Value {
+				return false
+			}
+		}
+
+		if exclusive != nil && exclusive(x.Key) && !x.Negated && !x.IsWildcard() {
+			if value, ok := values[x.Key]; ok && value != x.Value {
+				return false
+			}
+			values[x.Key] = x.Value
+		}
+	}
+
+	return true
+}
+
+// implies returns true if every workload that matches the clause also matches the tag
+func (t TagClause) implies(tag *Tag, exclusive func(key string) bool) bool {
+
+	for _, x := range t {
+
+		if x.Key != tag.Key {
+			continue
+		}
+
+		switch {
+
+		case *x == *tag:
+			return true
+
+		case !tag.Negated && tag.IsWildcard() && !x.Negated:
+			// key=value implies key=*
+			return true
+
+		case tag.Negated && !tag.IsWildcard() && x.Negated && x.IsWildcard():
+			// key!=* implies key!=value
+			return true
+
+		case tag.Negated && !tag.IsWildcard() && !x.Negated && !x.IsWildcard() && exclusive != nil && exclusive(x.Key):
+			// key=other implies key!=value when the key only has one value
+			if x.Value != tag.Value {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Subsumes returns true if every workload that matches other also matches the clause. A
+// clause that can not match anything is subsumed by every clause. Keys for which exclusive
+// returns true can only have one value; exclusive may be nil.
+func (t TagClause) Subsumes(other TagClause, exclusive func(key string) bool) bool {
+
+	if len(t) == 0 {
+		return !other.satisfiable(exclusive)
+	}
+
+	if !other.satisfiable(exclusive) {
+		return true
+	}
+
+	for _, x := range t {
+		if !other.implies(x, exclusive) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Intersects returns true if some workload can match both the clause and other. Keys for
+// which exclusive returns true can only have one value; exclusive may be nil.
+func (t TagClause) Intersects(other TagClause, exclusive func(key string) bool) bool {
+	return len(t) > 0 && len(other) > 0 && append(append(TagClause{}, t...), other...).satisfiable(exclusive)
+}
+
+func (t TagClause) String() string {
+	var s []string
+	for _, x := range t {
+		s = append(s, x.String())
+	}
+	return strings.Join(s, " ")
+}
+
+// TagExpression is a list of clauses that are ORed; it is a Subject or Object
+type TagExpression []TagClause
+
+// ParseTagExpression parses each clause of a Subject or Object
+func ParseTagExpression(s [][]string) (TagExpression, error) {
+
+	var t TagExpression
+
+	for _, x := range s {
+		clause, err := ParseTagClause(x)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, clause)
+	}
+
+	return t, nil
+}
+
+// Matches returns true if the workload tags match any clause of the expression
+func (t TagExpression) Matches(tags TagSet) bool {
+
+	for _, x := range t {
+		if x.Matches(tags) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subsumes returns true if every workload that matches other also matches the expression.
+// This is the case when each clause of other is subsumed by a clause of the expression. Keys
+// for which exclusive returns true can only have one value; exclusive may be nil.
+func (t TagExpression) Subsumes(other TagExpression, exclusive func(key string) bool) bool {
+
+	for _, x := range other {
+		subsumed := false
+		for _, y := range t {
+			if y.Subsumes(x, exclusive) {
+				subsumed = true
+				break
+			}
+		}
+		if !subsumed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Intersects returns true if some workload can match both the expression and other. Keys for
+// which exclusive returns true can only have one value; exclusive may be nil.
+func (t TagExpression) Intersects(other TagExpression, exclusive func(key string) bool) bool {
+
+	for _, x := range t {
+		for _, y := range other {
+			if x.Intersects(y, exclusive) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (t TagExpression) String() string {
+	var s []string
+	for _, x := range t {
+		s = append(s, "("+x.String()+")")
+	}
+	return strings.Join(s, " OR ")
+}
@@ -0,0 +1,289 @@
+package prisma
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// clause parses a clause written as space separated tags
+func clause(t *testing.T, s string) TagClause {
+
+	c, err := ParseTagClause(strings.Fields(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// expression parses an expression written as clauses separated by '|'
+func expression(t *testing.T, s string) TagExpression {
+
+	var e TagExpression
+
+	for _, x := range strings.Split(s, "|") {
+		if strings.TrimSpace(x) != "" {
+			e = append(e, clause(t, x))
+		}
+	}
+
+	return e
+}
+
+// exclusiveApp makes app the only key that can have just one value
+func exclusiveApp(key string) bool {
+	return key == "app"
+}
+
+func TestParseTag(t *testing.T) {
+
+	tests := []struct {
+		s    string
+		want Tag
+		fail bool
+	}{
+		{s: "app=web", want: Tag{Key: "app", Value: "web"}},
+		{s: "app=*", want: Tag{Key: "app", Value: "*"}},
+		{s: "app!=web", want: Tag{Key: "app", Value: "web", Negated: true}},
+		{s: "@org:tenant=a=b", want: Tag{Key: "@org:tenant", Value: "a=b"}},
+		{s: "app", fail: true},
+		{s: "=web", fail: true},
+		{s: "!=web", fail: true},
+		{s: "app=", fail: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+
+			tag, err := ParseTag(test.s)
+
+			if test.fail {
+				if !errors.Is(err, ErrTagSyntax) {
+					t.Errorf("expected ErrTagSyntax, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *tag != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, *tag)
+			}
+
+			if tag.String() != test.s {
+				t.Errorf("expected %s, got %s", test.s, tag.String())
+			}
+		})
+	}
+}
+
+func TestTagClauseMatches(t *testing.T) {
+
+	tags := NewTagSet([]string{"app=web", "env=prod", "invalid"})
+
+	tests := []struct {
+		clause string
+		want   bool
+	}{
+		{"app=web", true},
+		{"app=web env=prod", true},
+		{"app=web env=dev", false},
+		{"app=*", true},
+		{"team=*", false},
+		{"app!=db", true},
+		{"app!=web", false},
+		{"team!=*", true},
+		{"app!=*", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.clause, func(t *testing.T) {
+			if got := clause(t, test.clause).Matches(tags); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTagClauseSatisfiable(t *testing.T) {
+
+	tests := []struct {
+		clause    string
+		exclusive func(string) bool
+		want      bool
+	}{
+		{"", nil, false},
+		{"app=web", nil, true},
+		{"app=web app!=web", nil, false},
+		{"app=web app!=*", nil, false},
+		{"app=* app!=*", nil, false},
+		{"app=web app!=db", nil, true},
+		{"app!=web app!=db", nil, true},
+		{"app=web app=db", nil, true},
+		{"app=web app=db", exclusiveApp, false},
+		{"app=web app=web", exclusiveApp, true},
+		{"app=web app=*", exclusiveApp, true},
+		{"env=prod env=dev", exclusiveApp, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.clause, func(t *testing.T) {
+			if got := clause(t, test.clause).satisfiable(test.exclusive); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTagClauseImplies(t *testing.T) {
+
+	tests := []struct {
+		clause    string
+		tag       string
+		exclusive func(string) bool
+		want      bool
+	}{
+		{"app=web", "app=web", nil, true},
+		{"app=web env=prod", "env=prod", nil, true},
+		{"app=web", "env=prod", nil, false},
+		{"app=web", "app=*", nil, true},
+		{"app=*", "app=web", nil, false},
+		{"app!=web", "app=*", nil, false},
+		{"app!=*", "app!=web", nil, true},
+		{"app!=web", "app!=*", nil, false},
+		{"app!=web", "app!=web", nil, true},
+		{"app=db", "app!=web", nil, false},
+		{"app=db", "app!=web", exclusiveApp, true},
+		{"app=web", "app!=web", exclusiveApp, false},
+		{"app=*", "app!=web", exclusiveApp, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.clause+" => "+test.tag, func(t *testing.T) {
+
+			tag, err := ParseTag(test.tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := clause(t, test.clause).implies(tag, test.exclusive); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTagClauseSubsumes(t *testing.T) {
+
+	tests := []struct {
+		clause, other string
+		exclusive     func(string) bool
+		want          bool
+	}{
+		{"app=web", "app=web", nil, true},
+		{"app=web", "app=web env=prod", nil, true},
+		{"app=web env=prod", "app=web", nil, false},
+		{"app=*", "app=web", nil, true},
+		{"app=web", "app=*", nil, false},
+		{"app!=db", "app=web", nil, false},
+		{"app!=db", "app=web", exclusiveApp, true},
+		{"app!=web", "app=web", exclusiveApp, false},
+		{"app!=web", "app!=*", nil, true},
+		{"app!=*", "app!=web", nil, false},
+		{"env=prod", "app=web app!=web", nil, true},
+		{"env=prod", "app=web app=db", exclusiveApp, true},
+		{"", "app=web app!=*", nil, true},
+		{"", "app=web", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.clause+" > "+test.other, func(t *testing.T) {
+			if got := clause(t, test.clause).Subsumes(clause(t, test.other), test.exclusive); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTagClauseIntersects(t *testing.T) {
+
+	tests := []struct {
+		clause, other string
+		exclusive     func(string) bool
+		want          bool
+	}{
+		{"app=web", "env=prod", nil, true},
+		{"app=web", "app=web", nil, true},
+		{"app=web", "app!=web", nil, false},
+		{"app=web", "app!=db", nil, true},
+		{"app=*", "app!=*", nil, false},
+		{"app=web", "app!=*", nil, false},
+		{"app=web", "app=db", nil, true},
+		{"app=web", "app=db", exclusiveApp, false},
+		{"app=web", "app=*", exclusiveApp, true},
+		{"", "app=web", nil, false},
+		{"app=web", "", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.clause+" & "+test.other, func(t *testing.T) {
+			if got := clause(t, test.clause).Intersects(clause(t, test.other), test.exclusive); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTagExpressionSubsumes(t *testing.T) {
+
+	tests := []struct {
+		expression, other string
+		exclusive         func(string) bool
+		want              bool
+	}{
+		{"app=web | app=db", "app=web env=prod", nil, true},
+		{"app=web | app=db", "app=web | app=db env=prod", nil, true},
+		{"app=web", "app=web | app=db", nil, false},
+		{"app=*", "app=web | app=db", nil, true},
+		{"app!=cache", "app=web | app=db", exclusiveApp, true},
+		{"app!=cache", "app=web | app=cache", exclusiveApp, false},
+		{"app=web", "", nil, true},
+		{"", "app=web", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression+" > "+test.other, func(t *testing.T) {
+			if got := expression(t, test.expression).Subsumes(expression(t, test.other), test.exclusive); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTagExpressionIntersects(t *testing.T) {
+
+	tests := []struct {
+		expression, other string
+		exclusive         func(string) bool
+		want              bool
+	}{
+		{"app=web | app=db", "app=db env=prod", nil, true},
+		{"app=web", "app!=web", nil, false},
+		{"app=web | app=db", "app!=web", nil, true},
+		{"app=web", "app=db | app=cache", exclusiveApp, false},
+		{"app=web", "app=db | app=cache", nil, true},
+		{"", "app=web", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression+" & "+test.other, func(t *testing.T) {
+			if got := expression(t, test.expression).Intersects(expression(t, test.other), test.exclusive); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// writeFileAtomic writes data to path so that path either holds the old or the new content
+// even if the process crashes. The data is written to a temporary file in the same directory,
+// synced to disk and then renamed over path. If path exists its permissions are kept.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+
+	dir := filepath.Dir(path)
+
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+
+	// Removing the temporary file fails once it has been renamed which is fine
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file %s : %w", tmp.Name(), err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync file %s : %w", tmp.Name(), err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename file %s to %s : %w", tmp.Name(), path, err)
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir syncs the directory so that a rename inside it is durable
+func syncDir(dir string) error {
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Not every platform supports syncing a directory so errors are not fatal
+	d.Sync()
+
+	return nil
+}
+
+// rollback restores the original content of every file changed by the run and removes the
+// backups of the run. This is used when a run fails part way through so that the tree is
+// left as it was before the run.
+func (t *Namespace) rollback(run *ManifestRun, files []*file) error {
+
+	var errors *multierror.Error
+
+	for i := len(files) - 1; i >= 0; i-- {
+
+		x := files[i]
+
+		log.Printf("rolling back file \"%s\"", x.path)
+
+		if err := writeFileAtomic(x.path, x.original, 0644); err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("failed to roll back file %s : %w", x.path, err))
+		}
+	}
+
+	if errors.ErrorOrNil() != nil {
+		// Keep the backups as they are the only copy of the files that could not be rolled back
+		log.Printf("rollback of run \"%s\" failed; backups are in \"%s\"", run.ID, filepath.Join(t.rootNamespace.path, originalDir, run.ID))
+		return errors.ErrorOrNil()
+	}
+
+	return os.RemoveAll(filepath.Join(t.rootNamespace.path, originalDir, run.ID))
+}
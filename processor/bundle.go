@@ -0,0 +1,31 @@
+package processor
+
+import (
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// Bundle is the api/import payload for the tree. It maps the path of each namespace relative
+// to the root to one prisma.OuterConfig for each file in the namespace. Each config keeps the
+// label of its file so that importing the bundle again replaces the same objects.
+type Bundle map[string][]*prisma.OuterConfig
+
+// Bundle sanatizes every file in this namespace and below in memory and returns the Bundle.
+// Nothing is written to disk. The caller should validate the tree after calling Bundle and
+// before using the result.
+func (t *Namespace) Bundle() Bundle {
+
+	bundle := make(Bundle)
+
+	for _, x := range t.files() {
+
+		if x.prismaConfig == nil {
+			continue
+		}
+
+		x.sanatizeConfig()
+
+		bundle[x.parent.rpath] = append(bundle[x.parent.rpath], &prisma.OuterConfig{Data: x.prismaConfig})
+	}
+
+	return bundle
+}
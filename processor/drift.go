@@ -0,0 +1,297 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// DriftChange is how an object differs between the tree and a snapshot
+type DriftChange string
+
+const (
+	// DriftAdded is an object that is in the snapshot but not in the tree
+	DriftAdded DriftChange = "added"
+	// DriftRemoved is an object that is in the tree but not in the snapshot
+	DriftRemoved DriftChange = "removed"
+	// DriftModified is an object that is in both but differs
+	DriftModified DriftChange = "modified"
+)
+
+// FieldDiff is a field that differs. Path is the path of the field within the object, for
+// example incomingRules[0].protocolPorts[1]. A value is nil if the field is not set.
+type FieldDiff struct {
+	Path     string      `json:"path" yaml:"path"`
+	Tree     interface{} `json:"tree,omitempty" yaml:"tree,omitempty"`
+	Snapshot interface{} `json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+}
+
+func (t *FieldDiff) String() string {
+	return fmt.Sprintf("%s: %s -> %s", t.Path, diffValue(t.Tree), diffValue(t.Snapshot))
+}
+
+// diffValue returns the value as JSON or <unset> if it is nil
+func diffValue(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// Drift is an object that differs between the tree and a snapshot. Objects are matched by
+// namespace, label, kind and name. Fields is set for modified objects.
+type Drift struct {
+	Namespace string       `json:"namespace" yaml:"namespace"`
+	Label     string       `json:"label" yaml:"label"`
+	Kind      PolicyKind   `json:"kind" yaml:"kind"`
+	Name      string       `json:"name" yaml:"name"`
+	Change    DriftChange  `json:"change" yaml:"change"`
+	Fields    []*FieldDiff `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+func (t *Drift) String() string {
+	return fmt.Sprintf("%s %s %s in namespace %s label \"%s\"", t.Change, t.Kind, t.Name, t.Namespace, t.Label)
+}
+
+// ReadExport reads a Prisma export as a Bundle. See IngestExport for the supported formats.
+func ReadExport(r io.Reader, namespace string) (Bundle, error) {
+
+	configs, err := parseExport(r, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := make(Bundle)
+
+	for _, x := range configs {
+		ns := strings.Trim(x.namespace, "/")
+		bundle[ns] = append(bundle[ns], &prisma.OuterConfig{Data: x.config})
+	}
+
+	return bundle, nil
+}
+
+// driftKey identifies an object of a bundle
+type driftKey struct {
+	namespace, label, name string
+	kind                   PolicyKind
+}
+
+// objects returns every object of the bundle in the namespaces by driftKey
+func (t Bundle) objects(namespaces map[string]bool) map[driftKey]interface{} {
+
+	result := make(map[driftKey]interface{})
+
+	for ns, configs := range t {
+
+		if !namespaces[ns] {
+			continue
+		}
+
+		for _, x := range configs {
+
+			if x.Data == nil || x.Data.Data == nil {
+				continue
+			}
+
+			add := func(kind PolicyKind, name string, object interface{}) {
+				result[driftKey{namespace: ns, label: x.Data.Label, name: name, kind: kind}] = object
+			}
+
+			for _, y := range x.Data.Data.Networkrulesetpolicies {
+				if y != nil {
+					add(PolicyKindNetworkrulesetpolicy, y.Name, y)
+				}
+			}
+
+			for _, y := range x.Data.Data.Externalnetworks {
+				if y != nil {
+					add(PolicyKindExternalnetwork, y.Name, y)
+				}
+			}
+
+			for _, y := range x.Data.Data.Apiauthorizationpolicies {
+				if y != nil {
+					add(PolicyKindAPIAuthorizationPolicy, y.Name, y)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// Drift compares the bundle of the tree with a snapshot, for example a Prisma export read with
+// ReadExport. Only the namespaces in the snapshot are compared. The result is sorted by
+// namespace, label, kind and name.
+func (t Bundle) Drift(snapshot Bundle) []*Drift {
+
+	namespaces := make(map[string]bool)
+	for ns := range snapshot {
+		namespaces[ns] = true
+	}
+
+	tree := t.objects(namespaces)
+	snap := snapshot.objects(namespaces)
+
+	var result []*Drift
+
+	newDrift := func(key driftKey, change DriftChange) *Drift {
+		return &Drift{Namespace: key.namespace, Label: key.label, Kind: key.kind, Name: key.name, Change: change}
+	}
+
+	for key, x := range tree {
+
+		y, ok := snap[key]
+		if !ok {
+			result = append(result, newDrift(key, DriftRemoved))
+			continue
+		}
+
+		if fields := FieldDiffs(x, y); len(fields) > 0 {
+			drift := newDrift(key, DriftModified)
+			drift.Fields = fields
+			result = append(result, drift)
+		}
+	}
+
+	for key := range snap {
+		if _, ok := tree[key]; !ok {
+			result = append(result, newDrift(key, DriftAdded))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Label != b.Label {
+			return a.Label < b.Label
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+
+	return result
+}
+
+// FieldDiffs returns the fields that differ between a and b. The objects are compared by their
+// JSON form; fields that are empty in one and unset in the other are equal.
+func FieldDiffs(a, b interface{}) []*FieldDiff {
+
+	var result []*FieldDiff
+
+	var walk func(path string, x, y interface{})
+	walk = func(path string, x, y interface{}) {
+
+		if isEmptyValue(x) && isEmptyValue(y) {
+			return
+		}
+
+		switch xv := x.(type) {
+
+		case map[string]interface{}:
+			if yv, ok := y.(map[string]interface{}); ok {
+				keys := make(map[string]bool)
+				for k := range xv {
+					keys[k] = true
+				}
+				for k := range yv {
+					keys[k] = true
+				}
+				var sorted []string
+				for k := range keys {
+					sorted = append(sorted, k)
+				}
+				sort.Strings(sorted)
+				for _, k := range sorted {
+					p := k
+					if path != "" {
+						p = path + "." + k
+					}
+					walk(p, xv[k], yv[k])
+				}
+				return
+			}
+
+		case []interface{}:
+			if yv, ok := y.([]interface{}); ok {
+				n := len(xv)
+				if len(yv) > n {
+					n = len(yv)
+				}
+				for i := 0; i < n; i++ {
+					var xi, yi interface{}
+					if i < len(xv) {
+						xi = xv[i]
+					}
+					if i < len(yv) {
+						yi = yv[i]
+					}
+					walk(fmt.Sprintf("%s[%d]", path, i), xi, yi)
+				}
+				return
+			}
+		}
+
+		if !reflect.DeepEqual(x, y) {
+			result = append(result, &FieldDiff{Path: path, Tree: x, Snapshot: y})
+		}
+	}
+
+	walk("", jsonValue(a), jsonValue(b))
+
+	return result
+}
+
+// jsonValue returns the generic JSON form of v
+func jsonValue(v interface{}) interface{} {
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil
+	}
+
+	return result
+}
+
+// isEmptyValue returns true if v is nil, false, zero, an empty string or an empty list or map
+func isEmptyValue(v interface{}) bool {
+
+	switch x := v.(type) {
+
+	case nil:
+		return true
+
+	case bool:
+		return !x
+
+	case float64:
+		return x == 0
+
+	case string:
+		return x == ""
+
+	case []interface{}:
+		return len(x) == 0
+
+	case map[string]interface{}:
+		return len(x) == 0
+	}
+
+	return false
+}
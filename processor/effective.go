@@ -0,0 +1,158 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// PolicyKind is the kind of an EffectivePolicy
+type PolicyKind string
+
+const (
+	// PolicyKindNetworkrulesetpolicy is a prisma.Networkrulesetpolicy
+	PolicyKindNetworkrulesetpolicy PolicyKind = "networkrulesetpolicy"
+	// PolicyKindExternalnetwork is a prisma.Externalnetwork
+	PolicyKindExternalnetwork PolicyKind = "externalnetwork"
+	// PolicyKindAPIAuthorizationPolicy is a prisma.APIAuthorizationPolicy
+	PolicyKindAPIAuthorizationPolicy PolicyKind = "apiauthorizationpolicy"
+)
+
+// EffectivePolicy is a policy that applies in a namespace. Namespace is the relative path of
+// the namespace the policy is defined in and Path is the file it is defined in. Propagated is
+// true if the policy is defined in an ancestor and applies because it propagates. Policy is
+// the *prisma.Networkrulesetpolicy, *prisma.Externalnetwork or *prisma.APIAuthorizationPolicy.
+type EffectivePolicy struct {
+	Kind       PolicyKind  `json:"kind" yaml:"kind"`
+	Name       string      `json:"name" yaml:"name"`
+	Namespace  string      `json:"namespace" yaml:"namespace"`
+	Path       string      `json:"path" yaml:"path"`
+	Propagated bool        `json:"propagated" yaml:"propagated"`
+	Policy     interface{} `json:"policy" yaml:"policy"`
+	file       *file
+}
+
+// Find returns the namespace with the path relative to the root. The path of the directory
+// of the namespace is also accepted. An empty path returns the root.
+func (t *Namespace) Find(path string) (*Namespace, error) {
+
+	rpath := filepath.ToSlash(filepath.Clean(path))
+
+	if rel, err := filepath.Rel(t.rootNamespace.path, path); err == nil && !strings.HasPrefix(rel, "..") {
+		rpath = filepath.ToSlash(rel)
+	}
+
+	ns := t.rootNamespace
+
+	if rpath == "." || rpath == "" {
+		return ns, nil
+	}
+
+	for _, name := range strings.Split(strings.Trim(rpath, "/"), "/") {
+		child := ns.childMap[name]
+		if child == nil {
+			return nil, fmt.Errorf("namespace %s does not exist", rpath)
+		}
+		ns = child
+	}
+
+	return ns, nil
+}
+
+// policies returns the policies defined in the files of this namespace sorted by file
+func (t *Namespace) policies() []*EffectivePolicy {
+
+	var names []string
+	for name := range t.fileMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []*EffectivePolicy
+
+	add := func(x *file, kind PolicyKind, name string, policy interface{}) {
+		result = append(result, &EffectivePolicy{
+			Kind:      kind,
+			Name:      name,
+			Namespace: t.rpath,
+			Path:      x.path,
+			Policy:    policy,
+			file:      x,
+		})
+	}
+
+	for _, name := range names {
+
+		x := t.fileMap[name]
+		if x.prismaConfig == nil || x.prismaConfig.Data == nil {
+			continue
+		}
+
+		for _, policy := range x.prismaConfig.Data.Networkrulesetpolicies {
+			if policy != nil {
+				add(x, PolicyKindNetworkrulesetpolicy, policy.Name, policy)
+			}
+		}
+
+		for _, policy := range x.prismaConfig.Data.Externalnetworks {
+			if policy != nil {
+				add(x, PolicyKindExternalnetwork, policy.Name, policy)
+			}
+		}
+
+		for _, policy := range x.prismaConfig.Data.Apiauthorizationpolicies {
+			if policy != nil {
+				add(x, PolicyKindAPIAuthorizationPolicy, policy.Name, policy)
+			}
+		}
+	}
+
+	return result
+}
+
+// propagates returns true if the policy applies to the namespaces below the one it is defined in
+func (t *EffectivePolicy) propagates() bool {
+
+	switch x := t.Policy.(type) {
+
+	case *prisma.Networkrulesetpolicy:
+		return x.Propagate
+
+	case *prisma.Externalnetwork:
+		return x.Propagate
+
+	case *prisma.APIAuthorizationPolicy:
+		return x.Propagate
+	}
+
+	return false
+}
+
+// EffectivePolicies returns every policy that applies in this namespace. These are the
+// policies defined in the namespace followed by the propagated policies of each ancestor from
+// the nearest up to the top level.
+func (t *Namespace) EffectivePolicies() []*EffectivePolicy {
+
+	result := t.policies()
+
+	ancestors := t.ancestors()
+
+	for i := len(ancestors) - 1; i >= 0; i-- {
+
+		if ancestors[i] == t {
+			continue
+		}
+
+		for _, x := range ancestors[i].policies() {
+			if x.propagates() {
+				x.Propagated = true
+				result = append(result, x)
+			}
+		}
+	}
+
+	return result
+}
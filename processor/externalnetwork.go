@@ -0,0 +1,271 @@
+package processor
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+const (
+	// externalnetworkIdentityTag is the tag Prisma adds to every external network
+	externalnetworkIdentityTag = "$identity=externalnetwork"
+	// externalnetworkNameKey is the key of the tag Prisma adds to every external network with its name
+	externalnetworkNameKey = "$name"
+)
+
+const (
+	// RuleIDExternalNetworkNotFound is reported when an object selects an external network that
+	// does not exist or is not visible from the namespace of the policy
+	RuleIDExternalNetworkNotFound RuleID = "external-network-not-found"
+	// RuleIDExternalNetworkEntryInvalid is reported when an entry is not a CIDR, IP address or DNS name
+	RuleIDExternalNetworkEntryInvalid RuleID = "external-network-entry-invalid"
+	// RuleIDExternalNetworkEntryHostBits is reported when a CIDR entry has host bits set
+	RuleIDExternalNetworkEntryHostBits RuleID = "external-network-entry-host-bits"
+	// RuleIDExternalNetworkEntryOverlap is reported when entries duplicate or overlap each other
+	RuleIDExternalNetworkEntryOverlap RuleID = "external-network-entry-overlap"
+	// RuleIDExternalNetworkAny is reported when an entry matches every address
+	RuleIDExternalNetworkAny RuleID = "external-network-any"
+)
+
+// ancestors returns the namespaces from the top level down to and including this namespace.
+// The root is not included.
+func (t *Namespace) ancestors() []*Namespace {
+
+	var result []*Namespace
+
+	ns := t.rootNamespace
+
+	for _, value := range t.values {
+		ns = ns.childMap[value]
+		if ns == nil {
+			break
+		}
+		result = append(result, ns)
+	}
+
+	return result
+}
+
+// externalnetworks returns the external networks defined in the files of this namespace
+// sorted by file
+func (t *Namespace) externalnetworks() []*prisma.Externalnetwork {
+
+	var result []*prisma.Externalnetwork
+
+	for _, x := range t.policies() {
+		if externalnetwork, ok := x.Policy.(*prisma.Externalnetwork); ok {
+			result = append(result, externalnetwork)
+		}
+	}
+
+	return result
+}
+
+// visibleExternalnetworks returns the external networks that may be referenced from this
+// namespace. These are the effective external networks; the networks of the namespace itself
+// and the networks of each parent that are propagated.
+func (t *Namespace) visibleExternalnetworks() []*prisma.Externalnetwork {
+
+	var result []*prisma.Externalnetwork
+
+	for _, x := range t.EffectivePolicies() {
+		if externalnetwork, ok := x.Policy.(*prisma.Externalnetwork); ok {
+			result = append(result, externalnetwork)
+		}
+	}
+
+	return result
+}
+
+// externalnetworkTagKeys returns the key of every associated tag of every external network in
+// the namespace and below. It is used to recognize objects that select external networks.
+func (t *Namespace) externalnetworkTagKeys() map[string]bool {
+
+	keys := make(map[string]bool)
+
+	var walk func(ns *Namespace)
+	walk = func(ns *Namespace) {
+		for _, externalnetwork := range ns.externalnetworks() {
+			for _, tag := range externalnetwork.AssociatedTags {
+				key, _ := keyValueSplit(tag)
+				keys[key] = true
+			}
+		}
+		for _, child := range ns.childMap {
+			walk(child)
+		}
+	}
+
+	walk(t)
+
+	return keys
+}
+
+// isExternalnetworkSelector returns true if the object entry selects external networks rather
+// than workloads in a namespace. This is the case when it does not have any hierarchy tags
+// and it either has the external network identity tag or a tag with the same key as a tag
+// associated with an external network.
+func isExternalnetworkSelector(object []string, hierarchy Hierarchy, keys map[string]bool) bool {
+
+	selector := false
+
+	for _, tag := range object {
+
+		key, _ := keyValueSplit(tag)
+
+		if hierarchy.index(key) >= 0 {
+			return false
+		}
+
+		if tag == externalnetworkIdentityTag || keys[key] {
+			selector = true
+		}
+	}
+
+	return selector
+}
+
+// externalnetworkMatches returns true if the tags carried by the external network match the
+// object entry
+func externalnetworkMatches(externalnetwork *prisma.Externalnetwork, object []string) bool {
+
+	clause, err := prisma.ParseTagClause(object)
+	if err != nil {
+		return false
+	}
+
+	tags := prisma.NewTagSet(append([]string{externalnetworkIdentityTag}, externalnetwork.AssociatedTags...))
+	tags.Add(externalnetworkNameKey, externalnetwork.Name)
+
+	return clause.Matches(tags)
+}
+
+// externalnetworkEntry is a parsed entry of an external network. Either prefix or name is set.
+type externalnetworkEntry struct {
+	prefix netip.Prefix
+	name   string
+}
+
+// parseExternalnetworkEntry parses an entry as a CIDR, an IP address or a DNS name. An IP address
+// is returned as a prefix of the full length. If the CIDR has host bits set hostBits is true.
+func parseExternalnetworkEntry(s string) (entry *externalnetworkEntry, hostBits bool, err error) {
+
+	if strings.Contains(s, "/") {
+
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, false, fmt.Errorf("%q is not a valid CIDR", s)
+		}
+
+		return &externalnetworkEntry{prefix: prefix.Masked()}, prefix.Masked() != prefix, nil
+	}
+
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return &externalnetworkEntry{prefix: netip.PrefixFrom(addr, addr.BitLen())}, false, nil
+	}
+
+	if !isDNSName(s) {
+		return nil, false, fmt.Errorf("%q is not a valid CIDR, IP address or DNS name", s)
+	}
+
+	return &externalnetworkEntry{name: strings.TrimSuffix(strings.ToLower(s), ".")}, false, nil
+}
+
+// isDNSName returns true if s is a valid DNS name. A leading '*.' wildcard and a trailing dot
+// are permitted. Names made up only of numeric labels are rejected as they are malformed IP
+// addresses.
+func isDNSName(s string) bool {
+
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "*."), ".")
+
+	if s == "" || len(s) > 253 {
+		return false
+	}
+
+	numeric := true
+
+	for _, label := range strings.Split(s, ".") {
+
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			switch {
+			case c >= '0' && c <= '9':
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+				numeric = false
+			default:
+				return false
+			}
+		}
+	}
+
+	return !numeric
+}
+
+// overlaps returns true if both entries match a common address or are the same DNS name
+func (t *externalnetworkEntry) overlaps(other *externalnetworkEntry) bool {
+
+	if t.name != "" || other.name != "" {
+		return t.name == other.name
+	}
+
+	return t.prefix.Overlaps(other.prefix)
+}
+
+// isAny returns true if the entry matches every IPv4 or every IPv6 address
+func (t *externalnetworkEntry) isAny() bool {
+	return t.name == "" && t.prefix.Bits() == 0
+}
+
+// externalnetworkCheck verifies every entry of the external network at index in the file. Each
+// entry must be a valid CIDR, IP address or DNS name, a CIDR may not have host bits set and
+// entries may not duplicate or overlap each other. Entries matching every address are reported
+// so that they are only used intentionally; the finding can be suppressed with a justification.
+func (t *file) externalnetworkCheck(index int, externalnetwork *prisma.Externalnetwork) Findings {
+
+	var findings Findings
+
+	addFinding := func(ruleID RuleID, entry int, format string, args ...interface{}) {
+		finding := t.newFinding(ruleID, format, args...)
+		finding.Policy = externalnetwork.Name
+		finding.Tag = externalnetwork.Entries[entry]
+		t.setPosition(finding, "data", "externalnetworks", index, "entries", entry)
+		findings = append(findings, finding)
+	}
+
+	var parsed []*externalnetworkEntry
+	var parsedIndex []int
+
+	for i, x := range externalnetwork.Entries {
+
+		entry, hostBits, err := parseExternalnetworkEntry(x)
+		if err != nil {
+			addFinding(RuleIDExternalNetworkEntryInvalid, i, "external network %s in file \"%s\" has an invalid entry: %s", externalnetwork.Name, t.path, err.Error())
+			continue
+		}
+
+		if hostBits {
+			addFinding(RuleIDExternalNetworkEntryHostBits, i, "external network %s in file \"%s\" has entry %s with host bits set; did you mean %s", externalnetwork.Name, t.path, x, entry.prefix.String())
+		}
+
+		if entry.isAny() {
+			addFinding(RuleIDExternalNetworkAny, i, "external network %s in file \"%s\" has entry %s which matches every address", externalnetwork.Name, t.path, x)
+		}
+
+		for j, other := range parsed {
+			if entry.overlaps(other) {
+				addFinding(RuleIDExternalNetworkEntryOverlap, i, "external network %s in file \"%s\" has entry %s which duplicates or overlaps %s", externalnetwork.Name, t.path, x, externalnetwork.Entries[parsedIndex[j]])
+				break
+			}
+		}
+
+		parsed = append(parsed, entry)
+		parsedIndex = append(parsedIndex, i)
+	}
+
+	return findings
+}
@@ -0,0 +1,336 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Severity is the severity of a Finding
+type Severity string
+
+const (
+	// SeverityError is a problem that must be fixed
+	SeverityError Severity = "error"
+	// SeverityWarning is a problem that should be looked at but is not fatal
+	SeverityWarning Severity = "warning"
+	// SeverityInfo is informational only
+	SeverityInfo Severity = "info"
+	// SeverityOff disables a rule. It is only used in configuration.
+	SeverityOff Severity = "off"
+)
+
+// SeverityFromString returns Severity from string. If the string is not a valid severity an error will be returned.
+func SeverityFromString(s string) (Severity, error) {
+
+	switch strings.ToLower(s) {
+
+	case "error":
+		return SeverityError, nil
+	case "warning":
+		return SeverityWarning, nil
+	case "info":
+		return SeverityInfo, nil
+	case "off":
+		return SeverityOff, nil
+	}
+
+	return SeverityOff, fmt.Errorf("String %s is not a valid Severity type", s)
+}
+
+// RuleID identifies the check that produced a Finding. Rule IDs are stable and are intended
+// to be used for configuration, suppression and reporting rather than the message text.
+type RuleID string
+
+const (
+	// RuleIDConfigMissing is reported when a file does not contain a prisma config
+	RuleIDConfigMissing RuleID = "config-missing"
+	// RuleIDLabelMismatch is reported when the config label does not match the file location
+	RuleIDLabelMismatch RuleID = "label-mismatch"
+	// RuleIDNamespaceNotFound is reported when an object references a namespace that does not exist
+	RuleIDNamespaceNotFound RuleID = "namespace-not-found"
+	// RuleIDTagInvalid is reported when a tag of an object is malformed
+	RuleIDTagInvalid RuleID = "tag-invalid"
+	// RuleIDProtocolPortInvalid is reported when a protocol port is malformed
+	RuleIDProtocolPortInvalid RuleID = "protocol-port-invalid"
+	// RuleIDProtocolPortOutOfRange is reported when a port, protocol number or ICMP type or code is out of range
+	RuleIDProtocolPortOutOfRange RuleID = "protocol-port-out-of-range"
+	// RuleIDProtocolPortOverlap is reported when protocol ports within a rule overlap
+	RuleIDProtocolPortOverlap RuleID = "protocol-port-overlap"
+)
+
+// defaultSeverities holds the severity of the rules that are not errors by default
+var defaultSeverities = map[RuleID]Severity{
+	RuleIDProtocolPortOverlap:         SeverityWarning,
+	RuleIDExternalNetworkEntryOverlap: SeverityWarning,
+	RuleIDExternalNetworkAny:          SeverityWarning,
+	RuleIDRuleDuplicate:               SeverityWarning,
+	RuleIDRuleRedundant:               SeverityWarning,
+	RuleIDRuleShadowed:                SeverityWarning,
+	RuleIDFlowOneSided:                SeverityWarning,
+}
+
+// ruleIDs holds every RuleID other than the missing tag rules, which depend on the hierarchy
+var ruleIDs = []RuleID{
+	RuleIDConfigMissing,
+	RuleIDLabelMismatch,
+	RuleIDNamespaceNotFound,
+	RuleIDTagInvalid,
+	RuleIDProtocolPortInvalid,
+	RuleIDProtocolPortOutOfRange,
+	RuleIDProtocolPortOverlap,
+	RuleIDExternalNetworkNotFound,
+	RuleIDExternalNetworkEntryInvalid,
+	RuleIDExternalNetworkEntryHostBits,
+	RuleIDExternalNetworkEntryOverlap,
+	RuleIDExternalNetworkAny,
+	RuleIDRuleDuplicate,
+	RuleIDRuleRedundant,
+	RuleIDRuleShadowed,
+	RuleIDFlowOneSided,
+	RuleIDSuppressionInvalid,
+}
+
+// known returns true if the rule is one of ruleIDs or a missing tag rule for a level of the
+// hierarchy
+func (t RuleID) known(hierarchy Hierarchy) bool {
+
+	for _, x := range ruleIDs {
+		if x == t {
+			return true
+		}
+	}
+
+	for _, level := range hierarchy {
+		if missingTagRuleID(level.Name) == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DefaultSeverity returns the severity of the rule when it is not configured
+func (t RuleID) DefaultSeverity() Severity {
+	if severity, ok := defaultSeverities[t]; ok {
+		return severity
+	}
+	return SeverityError
+}
+
+// missingTagRuleID returns the RuleID reported when an object is missing the tag for the
+// hierarchy level with the specified name. For example "missing-tenant-tag".
+func missingTagRuleID(level string) RuleID {
+	return RuleID("missing-" + level + "-tag")
+}
+
+// Finding is a single problem found during validation
+type Finding struct {
+	RuleID    RuleID   `json:"ruleId" yaml:"ruleId"`
+	Severity  Severity `json:"severity" yaml:"severity"`
+	Path      string   `json:"path" yaml:"path"`
+	Namespace string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Policy    string   `json:"policy,omitempty" yaml:"policy,omitempty"`
+	Direction string   `json:"direction,omitempty" yaml:"direction,omitempty"`
+	Tag       string   `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Line      int      `json:"line,omitempty" yaml:"line,omitempty"`
+	Column    int      `json:"column,omitempty" yaml:"column,omitempty"`
+	Message   string   `json:"message" yaml:"message"`
+	// Suppressed is set when the finding is suppressed by a policy annotation. Suppressed
+	// findings are kept so that they can be audited.
+	Suppressed    bool   `json:"suppressed,omitempty" yaml:"suppressed,omitempty"`
+	Justification string `json:"justification,omitempty" yaml:"justification,omitempty"`
+}
+
+// Error returns the Finding as an error message. If the position is known it is appended.
+func (t *Finding) Error() string {
+	if t.Line > 0 {
+		return fmt.Sprintf("%s at line %d column %d", t.Message, t.Line, t.Column)
+	}
+	return t.Message
+}
+
+func (t *Finding) String() string {
+	s, _ := json.Marshal(t)
+	return string(s)
+}
+
+// Findings is a collection of Finding
+type Findings []*Finding
+
+// ErrorOrNil returns the findings as collated errors or nil if there are no findings
+func (t Findings) ErrorOrNil() error {
+
+	var errors *multierror.Error
+
+	for _, x := range t {
+		errors = multierror.Append(errors, x)
+	}
+
+	return errors.ErrorOrNil()
+}
+
+// newFinding returns a new Finding for the file with the message formatted from format and args
+func (t *file) newFinding(ruleID RuleID, format string, args ...interface{}) *Finding {
+	return &Finding{
+		RuleID:    ruleID,
+		Severity:  ruleID.DefaultSeverity(),
+		Path:      t.path,
+		Namespace: t.parent.label,
+		Message:   fmt.Sprintf(format, args...),
+	}
+}
+
+// setPosition sets the line and column of the finding to the position of the node found by
+// walking path from the document root. If the node does not exist the closest parent that
+// does exist is used.
+func (t *file) setPosition(finding *Finding, path ...interface{}) {
+
+	for i := len(path); i >= 0; i-- {
+		if node := nodeLookup(t.node, path[:i]...); node != nil {
+			finding.Line = node.Line
+			finding.Column = node.Column
+			return
+		}
+	}
+}
+
+// Description returns a short human readable description of the rule
+func (t RuleID) Description() string {
+
+	switch t {
+
+	case RuleIDConfigMissing:
+		return "The file does not contain a prisma config"
+
+	case RuleIDLabelMismatch:
+		return "The config label does not match the location of the file"
+
+	case RuleIDNamespaceNotFound:
+		return "An object references a namespace that does not exist"
+
+	case RuleIDTagInvalid:
+		return "A tag of an object is malformed"
+
+	case RuleIDProtocolPortInvalid:
+		return "A protocol port is malformed"
+
+	case RuleIDProtocolPortOutOfRange:
+		return "A port, protocol number or ICMP type or code is out of range"
+
+	case RuleIDProtocolPortOverlap:
+		return "Protocol ports within a rule overlap"
+
+	case RuleIDExternalNetworkNotFound:
+		return "An object selects an external network that does not exist or is not visible"
+
+	case RuleIDExternalNetworkEntryInvalid:
+		return "An external network entry is not a valid CIDR, IP address or DNS name"
+
+	case RuleIDExternalNetworkEntryHostBits:
+		return "An external network CIDR entry has host bits set"
+
+	case RuleIDExternalNetworkEntryOverlap:
+		return "External network entries duplicate or overlap each other"
+
+	case RuleIDExternalNetworkAny:
+		return "An external network entry matches every address; suppress with a justification if intentional"
+
+	case RuleIDRuleDuplicate:
+		return "A rule is a duplicate of an earlier rule in the same ruleset"
+
+	case RuleIDRuleRedundant:
+		return "A rule is covered by an earlier rule with the same action"
+
+	case RuleIDRuleShadowed:
+		return "An Allow rule is covered by a Reject rule and can never take effect"
+
+	case RuleIDFlowOneSided:
+		return "An outgoing Allow rule targets a namespace that does not accept the traffic"
+
+	case RuleIDSuppressionInvalid:
+		return "A lint-ignore annotation is malformed or has no justification"
+
+	}
+
+	if strings.HasPrefix(string(t), "missing-") && strings.HasSuffix(string(t), "-tag") {
+		level := strings.TrimSuffix(strings.TrimPrefix(string(t), "missing-"), "-tag")
+		return "An object does not have the " + level + " tag required by its hierarchy"
+	}
+
+	return string(t)
+}
+
+// Sort sorts the findings by path, position, rule ID and message so that output is stable
+func (t Findings) Sort() {
+	sort.SliceStable(t, func(i, j int) bool {
+		if t[i].Path != t[j].Path {
+			return t[i].Path < t[j].Path
+		}
+		if t[i].Line != t[j].Line {
+			return t[i].Line < t[j].Line
+		}
+		if t[i].Column != t[j].Column {
+			return t[i].Column < t[j].Column
+		}
+		if t[i].RuleID != t[j].RuleID {
+			return t[i].RuleID < t[j].RuleID
+		}
+		return t[i].Message < t[j].Message
+	})
+}
+
+// WithSeverity returns the findings that have the specified severity
+func (t Findings) WithSeverity(severity Severity) Findings {
+
+	var result Findings
+
+	for _, x := range t {
+		if x.Severity == severity {
+			result = append(result, x)
+		}
+	}
+
+	return result
+}
+
+// Suppressed returns the findings that are suppressed
+func (t Findings) Suppressed() Findings {
+
+	var result Findings
+
+	for _, x := range t {
+		if x.Suppressed {
+			result = append(result, x)
+		}
+	}
+
+	return result
+}
+
+// Unsuppressed returns the findings that are not suppressed
+func (t Findings) Unsuppressed() Findings {
+
+	var result Findings
+
+	for _, x := range t {
+		if !x.Suppressed {
+			result = append(result, x)
+		}
+	}
+
+	return result
+}
+
+// HasErrors returns true if any of the findings that are not suppressed have a severity of error
+func (t Findings) HasErrors() bool {
+	for _, x := range t {
+		if x.Severity == SeverityError && !x.Suppressed {
+			return true
+		}
+	}
+	return false
+}
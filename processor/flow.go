@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"sort"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// RuleIDFlowOneSided is reported when an outgoing Allow rule targets a namespace in the tree
+// but no ruleset in that namespace accepts the traffic
+const RuleIDFlowOneSided RuleID = "flow-one-sided"
+
+// lookup returns the namespace identified by values where there is one value for each level
+// from the top down. Trailing empty values are ignored. If a level above the deepest value is
+// not set, the namespace does not exist or no value is set nil is returned.
+func (t *Namespace) lookup(values []string) *Namespace {
+
+	deepest := -1
+	for i, value := range values {
+		if value != "" {
+			deepest = i
+		}
+	}
+
+	if deepest < 0 {
+		return nil
+	}
+
+	ns := t.rootNamespace
+
+	for i := 0; i <= deepest; i++ {
+		if values[i] == "" {
+			return nil
+		}
+		ns = ns.childMap[values[i]]
+		if ns == nil {
+			return nil
+		}
+	}
+
+	return ns
+}
+
+// scopedRuleset is a ruleset, the file it is defined in and the namespace it applies to
+type scopedRuleset struct {
+	ruleset   *prisma.Networkrulesetpolicy
+	file      *file
+	namespace *Namespace
+}
+
+// rulesets returns the rulesets defined in the files of this namespace sorted by file
+func (t *Namespace) rulesets() []*scopedRuleset {
+	return scopedRulesets(t.policies(), t)
+}
+
+// applicableRulesets returns the rulesets that apply to workloads in this namespace. These are
+// the effective rulesets; the rulesets of the namespace and the propagated rulesets of its
+// ancestors.
+func (t *Namespace) applicableRulesets() []*scopedRuleset {
+	return scopedRulesets(t.EffectivePolicies(), t)
+}
+
+// scopedRulesets returns the rulesets of the policies scoped to the namespace
+func scopedRulesets(policies []*EffectivePolicy, ns *Namespace) []*scopedRuleset {
+
+	var result []*scopedRuleset
+
+	for _, x := range policies {
+		if ruleset, ok := x.Policy.(*prisma.Networkrulesetpolicy); ok {
+			result = append(result, &scopedRuleset{ruleset: ruleset, file: x.file, namespace: ns})
+		}
+	}
+
+	return result
+}
+
+// receivingRulesets returns the rulesets that may apply to workloads in this namespace or any
+// namespace below it. These are the applicable rulesets of the namespace and the rulesets of
+// its descendants.
+func (t *Namespace) receivingRulesets() []*scopedRuleset {
+
+	result := t.applicableRulesets()
+
+	var walk func(ns *Namespace)
+	walk = func(ns *Namespace) {
+		var names []string
+		for name := range ns.childMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := ns.childMap[name]
+			result = append(result, child.rulesets()...)
+			walk(child)
+		}
+	}
+
+	walk(t)
+
+	return result
+}
+
+// subjectTags returns the tags carried by workloads matched by the subject of the ruleset in
+// this namespace. Each subject entry is combined with the hierarchy tags of the namespace that
+// it does not already have, as a sanatized subject carries them. If the ruleset does not have
+// a subject only the hierarchy tags are returned.
+func (t *Namespace) subjectTags(ruleset *prisma.Networkrulesetpolicy) [][]string {
+
+	tags := t.hierarchy.tags(t.values)
+
+	if len(ruleset.Subject) == 0 {
+		return [][]string{tags}
+	}
+
+	var result [][]string
+	for _, subject := range ruleset.Subject {
+
+		seen := make(map[string]bool)
+		var entry []string
+
+		for _, tag := range append(append([]string{}, subject...), tags...) {
+			if !seen[tag] {
+				seen[tag] = true
+				entry = append(entry, tag)
+			}
+		}
+
+		result = append(result, entry)
+	}
+
+	return result
+}
+
+// flowAccepted returns true if a ruleset that applies to workloads in the target namespace
+// or below accepts traffic from the source workloads on any of the protocol ports. The
+// object is the entry of the outgoing rule that selects the target workloads. Expressions
+// are compared with prisma.TagClause.Intersects so that only flows that can not be accepted
+// are reported.
+func flowAccepted(target *Namespace, object prisma.TagClause, source prisma.TagExpression, protocolPorts []*prisma.ProtocolPort) bool {
+
+	exclusive := target.hierarchy.exclusive
+
+	for _, x := range target.receivingRulesets() {
+
+		subject, err := prisma.ParseTagExpression(x.namespace.subjectTags(x.ruleset))
+		if err != nil || !subject.Intersects(prisma.TagExpression{object}, exclusive) {
+			continue
+		}
+
+		for _, rule := range x.ruleset.IncomingRules {
+
+			if rule == nil || rule.Action != prisma.TrafficActionAllow {
+				continue
+			}
+
+			incoming, err := rule.ParsedProtocolPorts()
+			if err != nil || !protocolPortsOverlap(incoming, protocolPorts) {
+				continue
+			}
+
+			objects, err := prisma.ParseTagExpression(rule.Object)
+			if err == nil && objects.Intersects(source, exclusive) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// protocolPortsOverlap returns true if any protocol port in a overlaps any protocol port in b
+func protocolPortsOverlap(a, b []*prisma.ProtocolPort) bool {
+
+	for _, x := range a {
+		for _, y := range b {
+			if x.Overlaps(y) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
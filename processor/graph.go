@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"sort"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// FlowEndpoint is one end of a Flow. Tags is a subject or object entry. Namespace is the
+// relative path of the namespace the tags resolve to or empty if they do not resolve to a
+// namespace in the tree. If the tags select external networks Externalnetworks is the name of
+// each external network visible from the namespace of the rule that matches.
+type FlowEndpoint struct {
+	Tags             []string `json:"tags" yaml:"tags"`
+	Namespace        string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Externalnetworks []string `json:"externalnetworks,omitempty" yaml:"externalnetworks,omitempty"`
+}
+
+// Flow is the traffic from one endpoint to another allowed or rejected by a rule. For
+// OutgoingRules From is the subject and To is the object; for IncomingRules it is the reverse.
+type Flow struct {
+	From          *FlowEndpoint        `json:"from" yaml:"from"`
+	To            *FlowEndpoint        `json:"to" yaml:"to"`
+	Action        prisma.TrafficAction `json:"action" yaml:"action"`
+	ProtocolPorts []string             `json:"protocolPorts,omitempty" yaml:"protocolPorts,omitempty"`
+	Path          string               `json:"path" yaml:"path"`
+	Policy        string               `json:"policy" yaml:"policy"`
+	Direction     string               `json:"direction" yaml:"direction"`
+}
+
+// Flows returns the flows of every Allow and Reject rule defined in this namespace and the
+// namespaces below it. There is a flow for each combination of subject entry and object
+// entry. A ruleset without a subject uses the hierarchy tags of its namespace.
+func (t *Namespace) Flows() []*Flow {
+
+	var result []*Flow
+
+	keys := t.rootNamespace.externalnetworkTagKeys()
+
+	// endpoint returns the endpoint for the tags of a rule defined in the namespace. A subject
+	// that does not resolve to a namespace is in the namespace of the rule.
+	endpoint := func(tags []string, ns *Namespace, subject bool) *FlowEndpoint {
+
+		x := &FlowEndpoint{Tags: tags}
+
+		if isExternalnetworkSelector(tags, t.hierarchy, keys) {
+			for _, externalnetwork := range ns.visibleExternalnetworks() {
+				if externalnetworkMatches(externalnetwork, tags) {
+					x.Externalnetworks = append(x.Externalnetworks, externalnetwork.Name)
+				}
+			}
+			return x
+		}
+
+		if target := t.rootNamespace.lookup(t.hierarchy.values(tags)); target != nil {
+			x.Namespace = target.rpath
+		} else if subject {
+			x.Namespace = ns.rpath
+		}
+
+		return x
+	}
+
+	var walk func(ns *Namespace)
+	walk = func(ns *Namespace) {
+
+		for _, x := range ns.rulesets() {
+
+			subject := x.ruleset.Subject
+			if len(subject) == 0 {
+				subject = [][]string{ns.hierarchy.tags(ns.values)}
+			}
+
+			add := func(direction string, rules []*prisma.Rule) {
+				for _, rule := range rules {
+					if rule == nil || (rule.Action != prisma.TrafficActionAllow && rule.Action != prisma.TrafficActionReject) {
+						continue
+					}
+					for _, s := range subject {
+						for _, o := range rule.Object {
+							flow := &Flow{
+								From:          endpoint(s, ns, true),
+								To:            endpoint(o, ns, false),
+								Action:        rule.Action,
+								ProtocolPorts: rule.ProtocolPorts,
+								Path:          x.file.path,
+								Policy:        x.ruleset.Name,
+								Direction:     direction,
+							}
+							if direction == "IncomingRules" {
+								flow.From, flow.To = flow.To, flow.From
+							}
+							result = append(result, flow)
+						}
+					}
+				}
+			}
+
+			add("OutgoingRules", x.ruleset.OutgoingRules)
+			add("IncomingRules", x.ruleset.IncomingRules)
+		}
+
+		var names []string
+		for name := range ns.childMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			walk(ns.childMap[name])
+		}
+	}
+
+	walk(t)
+
+	return result
+}
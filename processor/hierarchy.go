@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// HierarchyLevel is a single level of the namespace hierarchy below the root. Name is used in
+// messages and rule IDs. TagKey is the key of the tag that identifies the namespace at this
+// level in subjects and objects.
+type HierarchyLevel struct {
+	Name   string `json:"name" yaml:"name"`
+	TagKey string `json:"tagKey" yaml:"tagKey"`
+}
+
+// Hierarchy is the ordered list of levels below the root namespace. The first level is the
+// highest (for example the tenant). The depth of the directory tree may not exceed the number
+// of levels.
+//
+// Example:
+//
+//	hierarchy:
+//	  - name: tenant
+//	    tagKey: "@org:tenant"
+//	  - name: region
+//	    tagKey: "@org:region"
+type Hierarchy []*HierarchyLevel
+
+// DefaultHierarchy returns the hierarchy used by Prisma; tenant, cloud, group and kubernetes
+func DefaultHierarchy() Hierarchy {
+	return Hierarchy{
+		{Name: "tenant", TagKey: "@org:tenant"},
+		{Name: "cloud", TagKey: "@org:cloudaccount"},
+		{Name: "group", TagKey: "@org:group"},
+		{Name: "kubernetes", TagKey: "@org:kubernetes"},
+	}
+}
+
+// check verifies that the hierarchy has at least one level and that names and tag keys are
+// set and unique
+func (t Hierarchy) check() error {
+
+	if len(t) == 0 {
+		return fmt.Errorf("hierarchy must have at least one level")
+	}
+
+	names := make(map[string]bool)
+	tagKeys := make(map[string]bool)
+
+	for i, x := range t {
+
+		if x == nil || x.Name == "" || x.TagKey == "" {
+			return fmt.Errorf("hierarchy level %d must have a name and a tagKey", i)
+		}
+
+		if strings.Contains(x.TagKey, "=") {
+			return fmt.Errorf("hierarchy level %s tagKey %s may not contain '='", x.Name, x.TagKey)
+		}
+
+		if names[x.Name] {
+			return fmt.Errorf("hierarchy level %s is not unique", x.Name)
+		}
+
+		if tagKeys[x.TagKey] {
+			return fmt.Errorf("hierarchy tagKey %s is not unique", x.TagKey)
+		}
+
+		names[x.Name] = true
+		tagKeys[x.TagKey] = true
+	}
+
+	return nil
+}
+
+// index returns the index of the level with the tag key or -1 if no level has the tag key
+func (t Hierarchy) index(tagKey string) int {
+
+	for i, x := range t {
+		if x.TagKey == tagKey {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isHierarchyTag returns true if the tag is managed by the hierarchy. These are the tags
+// with the key of any level and any other '@org:' tags.
+func (t Hierarchy) isHierarchyTag(tag string) bool {
+
+	if strings.HasPrefix(tag, "@org:") {
+		return true
+	}
+
+	key, _ := keyValueSplit(tag)
+
+	return t.index(key) >= 0
+}
+
+// tags returns the tags for a namespace with the specified values. There is one value for each
+// level from the top down to the namespace.
+func (t Hierarchy) tags(values []string) []string {
+
+	var tags []string
+
+	for i, value := range values {
+		tags = append(tags, t[i].TagKey+"="+value)
+	}
+
+	return tags
+}
+
+// values returns the value of the tag of each level in the object entry. A level that does not
+// have a tag, or only has a negated or wildcard tag, has an empty value.
+func (t Hierarchy) values(object []string) []string {
+
+	values := make([]string, len(t))
+
+	for _, x := range object {
+		tag, err := prisma.ParseTag(x)
+		if err != nil || tag.Negated || tag.IsWildcard() {
+			continue
+		}
+		if index := t.index(tag.Key); index >= 0 {
+			values[index] = tag.Value
+		}
+	}
+
+	return values
+}
+
+// exclusive returns true if the key is the tag key of a level. A workload is only in one
+// namespace so it has one value for each of these keys. It is used with prisma.TagClause.
+func (t Hierarchy) exclusive(key string) bool {
+	return t.index(key) >= 0
+}
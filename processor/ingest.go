@@ -0,0 +1,275 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// exportConfig is a config read from a Prisma export and the path of the namespace it lives in
+type exportConfig struct {
+	namespace string
+	config    *prisma.Config
+}
+
+// IngestExport writes the configs of a Prisma export into the directory tree at root. The
+// export may be JSON or YAML and may hold one or more prisma.OuterConfig or prisma.Config
+// documents, a list of them or a Bundle. The namespace is the Prisma path of the namespace the
+// configs live in, for example /841735782980352000/cloud1/cluster1/app; it is not needed for
+// a Bundle as each namespace is a key. One file is written for each label in each namespace;
+// configs with the same label are merged. Each file has the subject tags and label that
+// Sanatize would produce. Existing files are only replaced if force is true. The paths of the
+// files written are returned.
+func IngestExport(root, namespace string, r io.Reader, hierarchy Hierarchy, force bool) ([]string, error) {
+
+	if err := hierarchy.check(); err != nil {
+		return nil, err
+	}
+
+	configs, err := parseExport(r, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	rootNamespace := &Namespace{
+		path:      root,
+		childMap:  make(map[string]*Namespace),
+		hierarchy: hierarchy,
+	}
+	rootNamespace.rootNamespace = rootNamespace
+
+	// Configs are merged by the path of the file they are written to
+	fileMap := make(map[string]*file)
+
+	for _, x := range configs {
+
+		var names []string
+		for _, name := range strings.Split(strings.Trim(x.namespace, "/"), "/") {
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+
+		if len(names) == 0 {
+			return nil, fmt.Errorf("config with label \"%s\" does not have a namespace; configuration is not permitted in the root namespace", x.config.Label)
+		}
+
+		if len(names) > len(hierarchy) {
+			return nil, fmt.Errorf("namespace %s is deeper than the hierarchy", x.namespace)
+		}
+
+		for _, name := range names {
+			if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+				return nil, fmt.Errorf("namespace %s has the invalid name \"%s\"", x.namespace, name)
+			}
+		}
+
+		ns := rootNamespace
+		for _, name := range names {
+			child := ns.childMap[name]
+			if child == nil {
+				child = ns.newNamespace(name)
+				ns.childMap[name] = child
+			}
+			ns = child
+		}
+
+		filename := labelFilename(x.config.Label, ns.label)
+
+		if existing, ok := fileMap[ns.path+"/"+filename]; ok {
+			existing.prismaConfig.Data.Apiauthorizationpolicies = append(existing.prismaConfig.Data.Apiauthorizationpolicies, x.config.Data.Apiauthorizationpolicies...)
+			existing.prismaConfig.Data.Externalnetworks = append(existing.prismaConfig.Data.Externalnetworks, x.config.Data.Externalnetworks...)
+			existing.prismaConfig.Data.Networkrulesetpolicies = append(existing.prismaConfig.Data.Networkrulesetpolicies, x.config.Data.Networkrulesetpolicies...)
+			continue
+		}
+
+		f := ns.newFile(filename)
+		f.prismaConfig = x.config
+		fileMap[f.path] = f
+	}
+
+	var paths []string
+	for path := range fileMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var errors *multierror.Error
+	var written []string
+
+	for _, path := range paths {
+
+		f := fileMap[path]
+
+		// The names are checked above; this guards against anything that still escapes root
+		if !pathWithin(root, f.path) {
+			errors = multierror.Append(errors, fmt.Errorf("file \"%s\" is outside of \"%s\"; not writing it", f.path, root))
+			continue
+		}
+
+		if _, err := os.Stat(f.path); err == nil && !force {
+			errors = multierror.Append(errors, fmt.Errorf("file \"%s\" exists; not replacing it", f.path))
+			continue
+		}
+
+		f.sanatizeConfig()
+
+		data, err := f.render()
+		if err != nil {
+			errors = multierror.Append(errors, err)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(f.path), os.ModePerm); err != nil {
+			errors = multierror.Append(errors, err)
+			continue
+		}
+
+		if err := writeFileAtomic(f.path, data, 0644); err != nil {
+			errors = multierror.Append(errors, err)
+			continue
+		}
+
+		log.Printf("wrote file \"%s\"", f.path)
+		written = append(written, f.path)
+	}
+
+	return written, errors.ErrorOrNil()
+}
+
+// parseExport reads every document of the export. See IngestExport.
+func parseExport(r io.Reader, namespace string) ([]*exportConfig, error) {
+
+	var result []*exportConfig
+
+	var parse func(node *yaml.Node, namespace string) error
+	parse = func(node *yaml.Node, namespace string) error {
+
+		node = nodeResolve(node)
+		if node == nil {
+			return nil
+		}
+
+		switch node.Kind {
+
+		case yaml.SequenceNode:
+			for _, x := range node.Content {
+				if err := parse(x, namespace); err != nil {
+					return err
+				}
+			}
+			return nil
+
+		case yaml.MappingNode:
+
+		default:
+			return fmt.Errorf("line %d: expected a config", node.Line)
+		}
+
+		isConfig := func(x *yaml.Node) bool {
+			for _, key := range []string{"label", "apiVersion", "APIVersion", "data", "identities"} {
+				if nodeMappingValue(x, key) != nil {
+					return true
+				}
+			}
+			return false
+		}
+
+		if !isConfig(node) {
+			// A Bundle maps the path of each namespace to its configs
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if err := parse(node.Content[i+1], node.Content[i].Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// An OuterConfig holds a config in data where a config holds the data in data
+		if data := nodeResolve(nodeMappingValue(node, "data")); isConfig(data) && nodeMappingValue(node, "label") == nil {
+			node = data
+		}
+
+		config := &prisma.Config{}
+		if err := node.Decode(config); err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+
+		// The JSON key differs from the YAML key
+		if x := nodeMappingValue(node, "apiVersion"); x != nil {
+			if err := x.Decode(&config.APIVersion); err != nil {
+				return fmt.Errorf("line %d: %w", x.Line, err)
+			}
+		}
+
+		if config.Data == nil {
+			config.Data = &prisma.Data{}
+		}
+
+		result = append(result, &exportConfig{namespace: namespace, config: config})
+
+		return nil
+	}
+
+	decoder := yaml.NewDecoder(r)
+
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse export : %w", err)
+		}
+		if err := parse(&node, namespace); err != nil {
+			return nil, fmt.Errorf("failed to parse export : %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+var labelFilenameRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// labelFilename returns the name of the file for the label. A label that Sanatize produced
+// for the namespace is the namespace label followed by the filename. Other labels are
+// converted to a filename with a config file extension.
+func labelFilename(label, namespaceLabel string) string {
+
+	filename := strings.TrimPrefix(label, namespaceLabel+":")
+
+	filename = strings.Trim(labelFilenameRegexp.ReplaceAllString(filename, "-"), "-.")
+	if filename == "" {
+		filename = "export"
+	}
+
+	for _, extension := range configFileExtensions {
+		if strings.HasSuffix(filename, extension) {
+			return filename
+		}
+	}
+
+	return filename + ".yaml"
+}
+
+// pathWithin returns true if path is root or below it once both are cleaned
+func pathWithin(root, path string) bool {
+
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
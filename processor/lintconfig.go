@@ -0,0 +1,285 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LintConfigFilename is the name of the linter configuration file. It is found by walking up
+// from the injest directory.
+const LintConfigFilename = ".prisma-lint.yaml"
+
+// LintConfig is the linter configuration. Rules maps a rule ID to a severity. Overrides
+// change the severity of rules for files matching path globs; later overrides take
+// precedence over earlier ones and all overrides take precedence over Rules. Paths are
+// relative to the directory holding the configuration file. Hierarchy replaces the
+// DefaultHierarchy.
+//
+// Example:
+//
+//	hierarchy:
+//	  - name: tenant
+//	    tagKey: "@org:tenant"
+//	  - name: cloud
+//	    tagKey: "@org:cloudaccount"
+//	rules:
+//	  label-mismatch: warning
+//	  missing-kubernetes-tag: off
+//	overrides:
+//	  - paths: ["841735782980352000/cloud2/**"]
+//	    rules:
+//	      namespace-not-found: info
+type LintConfig struct {
+	Rules     map[RuleID]Severity `json:"rules,omitempty" yaml:"rules,omitempty"`
+	Overrides []*LintOverride     `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+	Hierarchy Hierarchy           `json:"hierarchy,omitempty" yaml:"hierarchy,omitempty"`
+	dir       string              // the directory holding the configuration file
+}
+
+// LintOverride changes the severity of rules for files matching any of the path globs. A
+// glob may use '*' and '?' to match within a path element and '**' to match any number of
+// path elements.
+type LintOverride struct {
+	Paths []string            `json:"paths" yaml:"paths"`
+	Rules map[RuleID]Severity `json:"rules" yaml:"rules"`
+}
+
+// NewLintConfig returns an empty LintConfig. Every rule has its default severity.
+func NewLintConfig() *LintConfig {
+	return &LintConfig{}
+}
+
+// FindLintConfig looks for LintConfigFilename in dir and each of its parents and loads the
+// first one found. If none is found an empty LintConfig is returned.
+func FindLintConfig(dir string) (*LintConfig, error) {
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+
+		path := filepath.Join(dir, LintConfigFilename)
+
+		if _, err := os.Stat(path); err == nil {
+			return LoadLintConfig(path)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return NewLintConfig(), nil
+		}
+		dir = parent
+	}
+}
+
+// LoadLintConfig loads the LintConfig from the file path
+func LoadLintConfig(path string) (*LintConfig, error) {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewLintConfig()
+
+	if err := yaml.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("failed to parse lint config %s : %w", path, err)
+	}
+
+	if err := t.check(); err != nil {
+		return nil, fmt.Errorf("invalid lint config %s : %w", path, err)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t.dir = filepath.Dir(abs)
+
+	log.Printf("loaded lint config \"%s\"", path)
+
+	return t, nil
+}
+
+// NamespaceHierarchy returns the configured Hierarchy or the DefaultHierarchy if none is configured
+func (t *LintConfig) NamespaceHierarchy() Hierarchy {
+	if len(t.Hierarchy) == 0 {
+		return DefaultHierarchy()
+	}
+	return t.Hierarchy
+}
+
+// check verifies that the hierarchy, every rule ID and every severity is valid and normalizes
+// the severities. A missing tag rule ID must name a level of the configured hierarchy.
+func (t *LintConfig) check() error {
+
+	if t.Hierarchy != nil {
+		if err := t.Hierarchy.check(); err != nil {
+			return err
+		}
+	}
+
+	hierarchy := t.NamespaceHierarchy()
+
+	checkRules := func(rules map[RuleID]Severity) error {
+		for ruleID, severity := range rules {
+			if !ruleID.known(hierarchy) {
+				return fmt.Errorf("rule %s is unknown", ruleID)
+			}
+			s, err := SeverityFromString(string(severity))
+			if err != nil {
+				return fmt.Errorf("rule %s : %w", ruleID, err)
+			}
+			rules[ruleID] = s
+		}
+		return nil
+	}
+
+	if err := checkRules(t.Rules); err != nil {
+		return err
+	}
+
+	for _, x := range t.Overrides {
+		if x == nil {
+			continue
+		}
+		if err := checkRules(x.Rules); err != nil {
+			return err
+		}
+		for _, pattern := range x.Paths {
+			if _, err := globRegexp(pattern); err != nil {
+				return fmt.Errorf("path %s : %w", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Apply returns the findings with the severity configured for each rule and path. Findings
+// for rules that are off are dropped.
+func (t *LintConfig) Apply(findings Findings) Findings {
+
+	var result Findings
+
+	for _, x := range findings {
+
+		severity, ok := t.severity(x.RuleID, x.Path)
+		if !ok {
+			result = append(result, x)
+			continue
+		}
+
+		if severity == SeverityOff {
+			continue
+		}
+
+		finding := *x
+		finding.Severity = severity
+		result = append(result, &finding)
+	}
+
+	return result
+}
+
+// severity returns the configured severity for the rule and file path. If the rule is not
+// configured false is returned.
+func (t *LintConfig) severity(ruleID RuleID, path string) (Severity, bool) {
+
+	severity, ok := t.Rules[ruleID]
+
+	rpath := filepath.ToSlash(path)
+	if t.dir != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			if rel, err := filepath.Rel(t.dir, abs); err == nil {
+				rpath = filepath.ToSlash(rel)
+			}
+		}
+	}
+
+	for _, x := range t.Overrides {
+
+		if x == nil {
+			continue
+		}
+
+		s, exist := x.Rules[ruleID]
+		if !exist {
+			continue
+		}
+
+		for _, pattern := range x.Paths {
+			if globMatch(pattern, rpath) {
+				severity = s
+				ok = true
+				break
+			}
+		}
+	}
+
+	return severity, ok
+}
+
+// globRegexp converts a path glob to a regular expression. '**' matches any number of path
+// elements, '*' matches within a path element and '?' matches a single character.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+
+	var sb strings.Builder
+
+	sb.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+
+		c := pattern[i]
+
+		switch {
+
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+
+		case c == '*':
+			sb.WriteString("[^/]*")
+
+		case c == '?':
+			sb.WriteString("[^/]")
+
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	sb.WriteString("$")
+
+	return regexp.Compile(sb.String())
+}
+
+// globMatch returns true if the slash separated path matches the glob pattern. A pattern
+// without a '/' is matched against the base name of the path.
+func globMatch(pattern, path string) bool {
+
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return false
+	}
+
+	if !strings.Contains(pattern, "/") {
+		return re.MatchString(filepath.Base(path))
+	}
+
+	return re.MatchString(strings.TrimPrefix(path, "./"))
+}
@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLintConfigCheck(t *testing.T) {
+
+	tests := []struct {
+		name, config string
+		err          string
+	}{
+		{"known rule", "rules: {label-mismatch: warning}", ""},
+		{"missing tag rule", "rules: {missing-kubernetes-tag: off}", ""},
+		{"unknown rule", "rules: {lable-mismatch: warning}", "rule lable-mismatch is unknown"},
+		{"unknown rule in override", "overrides: [{paths: ['a/**'], rules: {namespace-not-fund: info}}]", "rule namespace-not-fund is unknown"},
+		{"missing tag rule for a level not in the hierarchy", "hierarchy: [{name: tenant, tagKey: '@org:tenant'}]\nrules: {missing-cloud-tag: off}", "rule missing-cloud-tag is unknown"},
+		{"missing tag rule for a configured level", "hierarchy: [{name: region, tagKey: '@org:region'}]\nrules: {missing-region-tag: off}", ""},
+		{"invalid severity", "rules: {label-mismatch: loud}", "rule label-mismatch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			config := NewLintConfig()
+			if err := yaml.Unmarshal([]byte(test.config), config); err != nil {
+				t.Fatal(err)
+			}
+
+			err := config.check()
+
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected %s, got %v", test.err, err)
+			}
+		})
+	}
+}
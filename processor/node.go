@@ -0,0 +1,208 @@
+package processor
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// nodeLookup walks the YAML node tree following path and returns the node found or nil if
+// the path does not exist. Each element of path is either a string, which is used as a
+// mapping key, or an int, which is used as a sequence index.
+func nodeLookup(node *yaml.Node, path ...interface{}) *yaml.Node {
+
+	for _, element := range path {
+
+		node = nodeResolve(node)
+		if node == nil {
+			return nil
+		}
+
+		switch v := element.(type) {
+
+		case string:
+			node = nodeMappingValue(node, v)
+
+		case int:
+			if node.Kind != yaml.SequenceNode || v < 0 || v >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[v]
+
+		default:
+			return nil
+		}
+	}
+
+	return nodeResolve(node)
+}
+
+// nodeResolve returns the content node for document and alias nodes. Other nodes are
+// returned as is.
+func nodeResolve(node *yaml.Node) *yaml.Node {
+
+	for node != nil {
+
+		switch node.Kind {
+
+		case yaml.DocumentNode:
+			if len(node.Content) == 0 {
+				return nil
+			}
+			node = node.Content[0]
+
+		case yaml.AliasNode:
+			node = node.Alias
+
+		default:
+			return node
+		}
+	}
+
+	return nil
+}
+
+// nodeMappingValue returns the value node for key in the mapping node or nil if the key
+// does not exist or node is not a mapping
+func nodeMappingValue(node *yaml.Node, key string) *yaml.Node {
+
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// nodeSetMappingValue sets the value node for key in the mapping node. If the key exists its
+// value is replaced and the comments of the old value are kept, otherwise the key is added
+// to the end of the mapping.
+func nodeSetMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			old := node.Content[i+1]
+			if old != value {
+				value.HeadComment = old.HeadComment
+				value.LineComment = old.LineComment
+				value.FootComment = old.FootComment
+			}
+			node.Content[i+1] = value
+			return
+		}
+	}
+
+	node.Content = append(node.Content, newStringNode(nil, key), value)
+}
+
+// newStringNode returns a scalar node holding value. If old is a scalar node it is reused so
+// that its comments and quoting style are kept.
+func newStringNode(old *yaml.Node, value string) *yaml.Node {
+
+	if old != nil && old.Kind == yaml.ScalarNode {
+		if old.Value != value {
+			old.Value = value
+			old.Tag = "!!str"
+		}
+		return old
+	}
+
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: value,
+	}
+}
+
+// newSubjectNode returns a subject node ([][]string) with a single entry holding tags. The
+// old subject node is reused where possible. Each tag reuses the old scalar node with the
+// same value or, for tags matched by keyed (such as '@org' tags), the same key so that
+// comments (for example Helm style notes such as {{.Values.org.group}}) are carried over to
+// the new value.
+func newSubjectNode(old *yaml.Node, tags []string, keyed func(string) bool) *yaml.Node {
+
+	outer := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	inner := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+
+	var oldScalars []*yaml.Node
+
+	if old != nil && old.Kind == yaml.SequenceNode {
+		outer = old
+		for i, x := range old.Content {
+			if x.Kind != yaml.SequenceNode {
+				continue
+			}
+			if i == 0 {
+				inner = x
+			}
+			for _, y := range x.Content {
+				if y.Kind == yaml.ScalarNode {
+					oldScalars = append(oldScalars, y)
+				}
+			}
+		}
+	}
+
+	used := make(map[*yaml.Node]bool)
+
+	// take returns the first unused old scalar matched by match or nil
+	take := func(match func(*yaml.Node) bool) *yaml.Node {
+		for _, x := range oldScalars {
+			if !used[x] && match(x) {
+				used[x] = true
+				return x
+			}
+		}
+		return nil
+	}
+
+	var content []*yaml.Node
+
+	for _, tag := range tags {
+
+		node := take(func(x *yaml.Node) bool { return x.Value == tag })
+
+		if node == nil && keyed(tag) {
+			key, _ := keyValueSplit(tag)
+			node = take(func(x *yaml.Node) bool {
+				k, _ := keyValueSplit(x.Value)
+				return k == key
+			})
+		}
+
+		content = append(content, newStringNode(node, tag))
+	}
+
+	inner.Content = content
+	outer.Content = []*yaml.Node{inner}
+
+	return outer
+}
+
+// nodeIndent returns the indentation used by the document. The indentation is taken from
+// the first nested mapping found; if there is none the yaml package default of 4 is used.
+func nodeIndent(node *yaml.Node) int {
+
+	root := nodeResolve(node)
+	if root == nil || root.Kind != yaml.MappingNode {
+		return 4
+	}
+
+	for i := 1; i < len(root.Content); i += 2 {
+		child := nodeResolve(root.Content[i])
+		if child != nil && child.Kind == yaml.MappingNode && len(child.Content) > 0 {
+			if indent := child.Content[0].Column - root.Content[i-1].Column; indent > 0 && child.Content[0].Line != root.Content[i-1].Line {
+				return indent
+			}
+		}
+	}
+
+	return 4
+}
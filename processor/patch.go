@@ -0,0 +1,477 @@
+package processor
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// nodeEdit records the value of a mapping entry before it is changed so that the change can
+// later be written by patching the original bytes rather than by encoding the whole document
+type nodeEdit struct {
+	mapping *yaml.Node                  // the mapping holding the entry
+	key     *yaml.Node                  // the key node of the entry
+	scalars []*yaml.Node                // the scalar nodes of the old value in document order
+	values  []string                    // the old value of each scalar
+	shape   map[*yaml.Node][]*yaml.Node // the content of each collection node of the old value
+	last    int                         // the last line holding a node of the old value
+	margin  int                         // the indentation of the old value if it starts on its own line
+}
+
+// newNodeEdit returns a nodeEdit for key in mapping. It must be called before the value is
+// changed. Nil is returned if the key does not exist.
+func newNodeEdit(mapping *yaml.Node, key string) *nodeEdit {
+
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+
+		if mapping.Content[i].Value != key {
+			continue
+		}
+
+		edit := &nodeEdit{
+			mapping: mapping,
+			key:     mapping.Content[i],
+			shape:   make(map[*yaml.Node][]*yaml.Node),
+			last:    mapping.Content[i].Line,
+			margin:  mapping.Content[i].Column - 1,
+		}
+
+		if value := mapping.Content[i+1]; value.Line > edit.key.Line {
+			edit.margin = value.Column - 1
+		}
+
+		nodeWalk(mapping.Content[i+1], func(x *yaml.Node) {
+			if x.Line > edit.last {
+				edit.last = x.Line
+			}
+			if x.Kind == yaml.ScalarNode {
+				edit.scalars = append(edit.scalars, x)
+				edit.values = append(edit.values, x.Value)
+				return
+			}
+			edit.shape[x] = append([]*yaml.Node(nil), x.Content...)
+		})
+
+		return edit
+	}
+
+	return nil
+}
+
+// nodeWalk calls fn for node and each node below it in document order. Aliases are not
+// followed.
+func nodeWalk(node *yaml.Node, fn func(*yaml.Node)) {
+
+	if node == nil {
+		return
+	}
+
+	fn(node)
+
+	if node.Kind == yaml.AliasNode {
+		return
+	}
+
+	for _, x := range node.Content {
+		nodeWalk(x, fn)
+	}
+}
+
+// patch is a replacement of the bytes between start and end
+type patch struct {
+	start, end int
+	text       string
+}
+
+// nodePatch applies edits to original and returns the result. Scalars that kept their place
+// are replaced in place so that quoting, comments and spacing around them are untouched;
+// otherwise the lines of the entry are replaced with the encoded entry. False is returned if
+// an edit can not be applied in this way, for example if the entry did not exist before.
+func nodePatch(original []byte, edits []*nodeEdit, indent int) ([]byte, bool) {
+
+	lines := bytes.SplitAfter(original, []byte("\n"))
+
+	offsets := make([]int, len(lines)+1)
+	for i, x := range lines {
+		offsets[i+1] = offsets[i] + len(x)
+	}
+
+	var patches []patch
+
+	for _, edit := range edits {
+
+		if edit == nil {
+			return nil, false
+		}
+
+		x, ok := edit.scalarPatches(lines, offsets)
+		if !ok {
+			var y patch
+			if y, ok = edit.blockPatch(original, lines, offsets, indent); !ok {
+				return nil, false
+			}
+			x = []patch{y}
+		}
+
+		patches = append(patches, x...)
+	}
+
+	sort.Slice(patches, func(i, j int) bool { return patches[i].start < patches[j].start })
+
+	var buf bytes.Buffer
+
+	pos := 0
+	for _, x := range patches {
+		if x.start < pos {
+			return nil, false
+		}
+		buf.Write(original[pos:x.start])
+		buf.WriteString(x.text)
+		pos = x.end
+	}
+	buf.Write(original[pos:])
+
+	return buf.Bytes(), true
+}
+
+// value returns the current value node of the entry
+func (t *nodeEdit) value() *yaml.Node {
+	return nodeMappingValue(t.mapping, t.key.Value)
+}
+
+// scalarPatches returns a patch for each scalar that changed. False is returned unless the
+// value still has the same structure and each changed scalar can be found in the original.
+func (t *nodeEdit) scalarPatches(lines [][]byte, offsets []int) ([]patch, bool) {
+
+	var scalars []*yaml.Node
+	same := true
+
+	nodeWalk(t.value(), func(x *yaml.Node) {
+		if x.Kind == yaml.ScalarNode {
+			scalars = append(scalars, x)
+			return
+		}
+		old, ok := t.shape[x]
+		if !ok || len(old) != len(x.Content) {
+			same = false
+			return
+		}
+		for i := range old {
+			if old[i] != x.Content[i] {
+				same = false
+			}
+		}
+	})
+
+	if !same || len(scalars) != len(t.scalars) {
+		return nil, false
+	}
+
+	var patches []patch
+
+	for i, x := range scalars {
+
+		if x != t.scalars[i] {
+			return nil, false
+		}
+
+		if x.Value == t.values[i] {
+			continue
+		}
+
+		start, end, ok := scalarRange(lines, x, t.values[i])
+		if !ok {
+			return nil, false
+		}
+
+		text, ok := scalarText(x)
+		if !ok {
+			return nil, false
+		}
+
+		patches = append(patches, patch{start: offsets[x.Line-1] + start, end: offsets[x.Line-1] + end, text: text})
+	}
+
+	return patches, true
+}
+
+// blockPatch returns a patch replacing everything after the key up to the end of the last
+// line of the old value with the encoded entry. The old value ends at the last line holding
+// one of its nodes or the closing bracket of one of its flow collections.
+func (t *nodeEdit) blockPatch(original []byte, lines [][]byte, offsets []int, indent int) (patch, bool) {
+
+	if t.mapping.Style&yaml.FlowStyle != 0 || t.key.Style != 0 || t.last > len(lines) {
+		return patch{}, false
+	}
+
+	last := t.last
+
+	for x := range t.shape {
+		if x.Style&yaml.FlowStyle == 0 {
+			continue
+		}
+		line, ok := flowEnd(original, lines, offsets, x)
+		if !ok {
+			return patch{}, false
+		}
+		if line > last {
+			last = line
+		}
+	}
+
+	// Another entry on the lines of the old value can not be kept apart from it
+	for i := 0; i+1 < len(t.mapping.Content); i += 2 {
+		if x := t.mapping.Content[i]; x != t.key && x.Line >= t.key.Line && x.Line <= last {
+			return patch{}, false
+		}
+	}
+
+	start, ok := columnOffset(lines[t.key.Line-1], t.key.Column)
+	if !ok || !bytes.HasPrefix(lines[t.key.Line-1][start:], []byte(t.key.Value)) {
+		return patch{}, false
+	}
+	start += len(t.key.Value)
+
+	end := len(bytes.TrimRight(lines[last-1], "\r\n"))
+
+	// The encoded lines use the line ending of the original
+	newline := "\n"
+	if bytes.HasSuffix(lines[t.key.Line-1], []byte("\r\n")) {
+		newline = "\r\n"
+	}
+
+	// Comments above the key and below the value are outside of the replaced lines
+	key := *t.key
+	key.HeadComment = ""
+	key.FootComment = ""
+
+	value := nodeCopy(t.value())
+	for x := value; x != nil; {
+		x.FootComment = ""
+		if x.Kind == yaml.AliasNode || len(x.Content) == 0 {
+			break
+		}
+		x = x.Content[len(x.Content)-1]
+	}
+
+	var buf bytes.Buffer
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+
+	if err := encoder.Encode(&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{&key, value}}); err != nil {
+		return patch{}, false
+	}
+
+	if err := encoder.Close(); err != nil {
+		return patch{}, false
+	}
+
+	encoded := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if !strings.HasPrefix(encoded[0], t.key.Value) {
+		return patch{}, false
+	}
+
+	// The encoded lines are moved to where the old value started
+	indentation := 0
+	if len(encoded) > 1 {
+		indentation = len(encoded[1]) - len(strings.TrimLeft(encoded[1], " "))
+	}
+
+	margin := strings.Repeat(" ", t.margin)
+
+	text := strings.TrimPrefix(encoded[0], t.key.Value)
+	for _, x := range encoded[1:] {
+		if strings.TrimLeft(x, " ") == "" {
+			text += newline
+			continue
+		}
+		if len(x)-len(strings.TrimLeft(x, " ")) < indentation {
+			return patch{}, false
+		}
+		text += newline + margin + x[indentation:]
+	}
+
+	return patch{start: offsets[t.key.Line-1] + start, end: offsets[last-1] + end, text: text}, true
+}
+
+// flowEnd returns the line of the bracket closing the flow collection node in the original.
+// Quoted scalars and comments are skipped.
+func flowEnd(original []byte, lines [][]byte, offsets []int, node *yaml.Node) (int, bool) {
+
+	if node.Line < 1 || node.Line > len(lines) {
+		return 0, false
+	}
+
+	start, ok := columnOffset(lines[node.Line-1], node.Column)
+	if !ok {
+		return 0, false
+	}
+	start += offsets[node.Line-1]
+
+	if start >= len(original) || (original[start] != '[' && original[start] != '{') {
+		return 0, false
+	}
+
+	depth := 0
+
+	for i := start; i < len(original); i++ {
+
+		switch original[i] {
+
+		case '[', '{':
+			depth++
+
+		case ']', '}':
+			depth--
+			if depth == 0 {
+				// offsets holds the start of each line so the line is the last start not after i
+				return sort.Search(len(offsets), func(j int) bool { return offsets[j] > i }), true
+			}
+
+		case '\'':
+			for i++; i < len(original); i++ {
+				if original[i] == '\'' {
+					if i+1 < len(original) && original[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+
+		case '"':
+			for i++; i < len(original) && original[i] != '"'; i++ {
+				if original[i] == '\\' {
+					i++
+				}
+			}
+
+		case '#':
+			if i == 0 || original[i-1] == ' ' || original[i-1] == '\t' || original[i-1] == '\n' {
+				for i < len(original) && original[i] != '\n' {
+					i++
+				}
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// nodeCopy returns a deep copy of node. Aliases are not followed.
+func nodeCopy(node *yaml.Node) *yaml.Node {
+
+	if node == nil {
+		return nil
+	}
+
+	x := *node
+
+	if node.Kind != yaml.AliasNode {
+		x.Content = nil
+		for _, y := range node.Content {
+			x.Content = append(x.Content, nodeCopy(y))
+		}
+	}
+
+	return &x
+}
+
+// scalarRange returns the start and end of the scalar node in its line of the original. The
+// scalar must be plain or quoted and fit on a single line.
+func scalarRange(lines [][]byte, node *yaml.Node, value string) (int, int, bool) {
+
+	if node.Line < 1 || node.Line > len(lines) {
+		return 0, 0, false
+	}
+
+	line := lines[node.Line-1]
+
+	start, ok := columnOffset(line, node.Column)
+	if !ok {
+		return 0, 0, false
+	}
+
+	switch node.Style {
+
+	case 0:
+		if !bytes.HasPrefix(line[start:], []byte(value)) {
+			return 0, 0, false
+		}
+		return start, start + len(value), true
+
+	case yaml.SingleQuotedStyle:
+		if start >= len(line) || line[start] != '\'' {
+			return 0, 0, false
+		}
+		for i := start + 1; i < len(line); i++ {
+			if line[i] != '\'' {
+				continue
+			}
+			if i+1 < len(line) && line[i+1] == '\'' {
+				i++
+				continue
+			}
+			return start, i + 1, true
+		}
+
+	case yaml.DoubleQuotedStyle:
+		if start >= len(line) || line[start] != '"' {
+			return 0, 0, false
+		}
+		for i := start + 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return start, i + 1, true
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// scalarText returns the scalar node encoded on its own without comments
+func scalarText(node *yaml.Node) (string, bool) {
+
+	x := *node
+	x.HeadComment = ""
+	x.LineComment = ""
+	x.FootComment = ""
+
+	b, err := yaml.Marshal(&x)
+	if err != nil {
+		return "", false
+	}
+
+	text := strings.TrimSuffix(string(b), "\n")
+	if strings.Contains(text, "\n") {
+		return "", false
+	}
+
+	return text, true
+}
+
+// columnOffset returns the byte offset of the 1 based character column in line
+func columnOffset(line []byte, column int) (int, bool) {
+
+	offset := 0
+	for i := 1; i < column; i++ {
+		if offset >= len(line) {
+			return 0, false
+		}
+		_, size := utf8.DecodeRune(line[offset:])
+		offset += size
+	}
+
+	return offset, true
+}
@@ -0,0 +1,308 @@
+package processor
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sanatizeYAML sanatizes content as a file in the namespace t1/c1 with the label
+// t1:c1:a.yaml and returns the rendered file
+func sanatizeYAML(t *testing.T, content string) string {
+
+	path := filepath.Join(t.TempDir(), "a.yaml")
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	namespace := &Namespace{
+		hierarchy: DefaultHierarchy(),
+		values:    []string{"t1", "c1"},
+	}
+
+	f := &file{parent: namespace, filename: "a.yaml", path: path, label: "t1:c1:a.yaml"}
+
+	if err := f.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	f.sanatizeConfig()
+
+	data, err := f.render()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.decodesTo(data) {
+		t.Errorf("rendered file does not decode to the config\n%s", data)
+	}
+
+	return string(data)
+}
+
+func TestRenderPatch(t *testing.T) {
+
+	tests := []struct {
+		name, content, want string
+	}{
+		{
+			name: "block style values replaced in place",
+			content: `label: t1:c1:a.yaml  # keep   spacing
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject:
+            - - app=web   # web
+              - "@org:tenant=old"
+              - '@org:cloudaccount=old'
+          protected: false
+`,
+			want: `label: t1:c1:a.yaml  # keep   spacing
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject:
+            - - app=web   # web
+              - "@org:tenant=t1"
+              - '@org:cloudaccount=c1'
+          protected: false
+`,
+		},
+		{
+			name: "block style restructured",
+			content: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        # the ruleset
+        - name: r1
+          # the subject
+          subject:
+            - - '@org:tenant=old'
+              - app=web # web
+            - - '@org:group=old'
+          # after the subject
+          protected: false
+`,
+			want: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        # the ruleset
+        - name: r1
+          # the subject
+          subject:
+            - - app=web # web
+              - '@org:tenant=t1'
+              - '@org:cloudaccount=c1'
+          # after the subject
+          protected: false
+`,
+		},
+		{
+			name: "flow style values replaced in place",
+			content: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject: [[app=web, "@org:tenant=old", '@org:cloudaccount=c1']]  # flow
+`,
+			want: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject: [[app=web, "@org:tenant=t1", '@org:cloudaccount=c1']]  # flow
+`,
+		},
+		{
+			name: "flow style restructured",
+			content: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject: [[app=web, "@org:tenant=old"]]
+          protected: false
+`,
+			want: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject: [[app=web, "@org:tenant=t1", '@org:cloudaccount=c1']]
+          protected: false
+`,
+		},
+		{
+			name: "multi-line flow style",
+			content: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject: [
+            ["app=web",
+             "@org:tenant=old"]
+          ]
+          protected: false
+`,
+			want: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject: [["app=web", "@org:tenant=t1", '@org:cloudaccount=c1']]
+          protected: false
+`,
+		},
+		{
+			name: "multi-line flow style with brackets in quotes and comments",
+			content: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject: [ # ]
+            ['app=]',
+             "@org:tenant=[old"] # ]
+          ]
+          protected: false
+`,
+			want: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject: [['app=]', "@org:tenant=t1", '@org:cloudaccount=c1'] # ]
+          ]
+          protected: false
+`,
+		},
+		{
+			name: "quoted label",
+			content: `label: "old"   # label
+data:
+    networkrulesetpolicies: []
+`,
+			want: `label: "t1:c1:a.yaml"   # label
+data:
+    networkrulesetpolicies: []
+`,
+		},
+		{
+			name: "alias to an anchor elsewhere",
+			content: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          description: &tag app=web
+          subject:
+            - - *tag
+              - '@org:tenant=old'
+          protected: false
+`,
+			// The alias is not a scalar so it is replaced by its value
+			want: `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          description: &tag app=web
+          subject:
+            - - app=web
+              - '@org:tenant=t1'
+              - '@org:cloudaccount=c1'
+          protected: false
+`,
+		},
+		{
+			name:    "crlf",
+			content: "label: t1:c1:a.yaml\r\ndata:\r\n    networkrulesetpolicies:\r\n        - name: r1\r\n          subject:\r\n            - - app=web\r\n          protected: false\r\n",
+			want:    "label: t1:c1:a.yaml\r\ndata:\r\n    networkrulesetpolicies:\r\n        - name: r1\r\n          subject:\r\n            - - app=web\r\n              - '@org:tenant=t1'\r\n              - '@org:cloudaccount=c1'\r\n          protected: false\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sanatizeYAML(t, test.content); got != test.want {
+				t.Errorf("expected\n%s\ngot\n%s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRenderAnchorOnChangedEntry(t *testing.T) {
+
+	// The object refers to the subject so changing the subject must not change the object
+	got := sanatizeYAML(t, `label: t1:c1:a.yaml
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject: &subject
+            - - app=web
+              - '@org:tenant=old'
+          outgoingRules:
+            - action: Allow
+              object: *subject
+`)
+
+	if !strings.Contains(got, "@org:tenant=old") {
+		t.Errorf("expected the object to keep @org:tenant=old\n%s", got)
+	}
+}
+
+func TestRenderLabelAdded(t *testing.T) {
+
+	// There is no label to patch so the node tree is encoded; comments are kept
+	got := sanatizeYAML(t, `# policies
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject:
+            - - app=web
+              - '@org:tenant=t1'
+              - '@org:cloudaccount=c1'
+`)
+
+	want := `# policies
+data:
+    networkrulesetpolicies:
+        - name: r1
+          subject:
+            - - app=web
+              - '@org:tenant=t1'
+              - '@org:cloudaccount=c1'
+label: t1:c1:a.yaml
+`
+
+	if got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestDecodesTo(t *testing.T) {
+
+	content := "label: t1:c1:a.yaml\ndata:\n    networkrulesetpolicies:\n        - name: r1\n          subject: [[app=web]]\n"
+
+	path := filepath.Join(t.TempDir(), "a.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &file{path: path}
+	if err := f.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, data string
+		want       bool
+	}{
+		{"same", content, true},
+		{"reformatted", "label: t1:c1:a.yaml\ndata:\n  networkrulesetpolicies:\n  - name: r1\n    subject:\n    - - app=web\n", true},
+		{"changed", strings.Replace(content, "app=web", "app=db", 1), false},
+		{"stray bracket", strings.Replace(content, "[[app=web]]\n", "[[app=web]]\n          ]\n", 1), false},
+		{"empty", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := f.decodesTo([]byte(test.data)); got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package processor
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"os"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/go-multierror"
@@ -25,6 +28,9 @@ import (
 // Group: This represents either a Kubernetes cluster or a logical grouping of VMs.
 // Kubernetes: This only applies if the Group is of type Kubernetes and corresponds to the Kubernetes namespace
 //
+// The levels below root are defined by a Hierarchy. The structure above is the DefaultHierarchy but
+// it may be replaced, for example with tenant, region, account, cluster and namespace.
+//
 // This utility expects to injest a directory strucutre that mimics the namespace strucutre defined above with the
 // following caveats:
 // 1) With the exception of the root directory, the name of each directory should correspond to the name in Prisma
@@ -34,14 +40,13 @@ import (
 // files. The rationalization for this is that the customer does not own the directory above tenant and may not
 // modify it.
 type Namespace struct {
-	rootNamespace                    *Namespace
-	childMap                         map[string]*Namespace
-	level                            metaLevel
-	tenant, cloud, group, kubernetes string
-	fileMap                          map[string]*file
-	path, rpath, label               string
-	restore                          string
-	verbose                          bool
+	rootNamespace      *Namespace
+	childMap           map[string]*Namespace
+	hierarchy          Hierarchy
+	values             []string // the name of this namespace and each parent down from the top level
+	fileMap            map[string]*file
+	path, rpath, label string
+	verbose            bool
 }
 
 // file represents a YAML config file. We are not exposing it outside of this package
@@ -50,22 +55,35 @@ type file struct {
 	filename           string
 	path, rpath, label string
 	prismaConfig       *prisma.Config
+	node               *yaml.Node  // the YAML document the config was decoded from; used for positions
+	original           []byte      // the content of the file as loaded
+	edits              []*nodeEdit // the entries of node changed since the file was loaded
 }
 
-// NewNamespace returns a new Namespace at the Root level. This Namespace base directory can be configured
-// as an option or the current working directory will be used. If there are errors a collection of wrapped
-// errors will be returned. If there are no errors nil will be returned.
+// NewNamespace returns a new Namespace at the Root level using the DefaultHierarchy. This Namespace base
+// directory can be configured as an option or the current working directory will be used. If there are errors
+// a collection of wrapped errors will be returned. If there are no errors nil will be returned.
 func NewNamespace(path string, verbose bool) (*Namespace, error) {
+	return NewNamespaceWithHierarchy(path, verbose, DefaultHierarchy())
+}
+
+// NewNamespaceWithHierarchy returns a new Namespace at the Root level using the specified hierarchy. See
+// NewNamespace.
+func NewNamespaceWithHierarchy(path string, verbose bool, hierarchy Hierarchy) (*Namespace, error) {
 
 	if path == "" {
 		return nil, fmt.Errorf("path is required")
 	}
 
+	if err := hierarchy.check(); err != nil {
+		return nil, err
+	}
+
 	t := &Namespace{
-		path:     path,
-		childMap: make(map[string]*Namespace),
-		level:    metaLevelRoot,
-		verbose:  verbose,
+		path:      path,
+		childMap:  make(map[string]*Namespace),
+		hierarchy: hierarchy,
+		verbose:   verbose,
 	}
 
 	t.rootNamespace = t
@@ -76,7 +94,8 @@ func NewNamespace(path string, verbose bool) (*Namespace, error) {
 	return t, t.read()
 }
 
-// This call is made for every directory that exist below root
+// This call is made for every directory that exist below root. The caller must verify that
+// the depth of the hierarchy has not been exceeded.
 func (t *Namespace) newNamespace(name string) *Namespace {
 
 	label := ""
@@ -93,12 +112,13 @@ func (t *Namespace) newNamespace(name string) *Namespace {
 		rpath = t.rpath + "/" + name
 	}
 
-	meta := &Namespace{
+	values := make([]string, len(t.values), len(t.values)+1)
+	copy(values, t.values)
+
+	return &Namespace{
 		verbose:       t.verbose,
-		tenant:        t.tenant,
-		cloud:         t.cloud,
-		group:         t.group,
-		kubernetes:    t.kubernetes,
+		hierarchy:     t.hierarchy,
+		values:        append(values, name),
 		path:          t.path + "/" + name,
 		rpath:         rpath,
 		label:         label,
@@ -106,91 +126,163 @@ func (t *Namespace) newNamespace(name string) *Namespace {
 		fileMap:       make(map[string]*file),
 		rootNamespace: t.rootNamespace,
 	}
+}
 
-	switch t.level {
-
-	case metaLevelRoot:
-		meta.level = metaLevelTenant
-		meta.tenant = name
-		return meta
-
-	case metaLevelTenant:
-		meta.level = metaLevelCloud
-		meta.cloud = name
-		return meta
-
-	case metaLevelCloud:
-		meta.level = metaLevelGroup
-		meta.group = name
-		return meta
+// depth returns the depth of the namespace. The root has a depth of 0 and the top level of
+// the hierarchy (for example the tenant) has a depth of 1.
+func (t *Namespace) depth() int {
+	return len(t.values)
+}
 
-	case metaLevelGroup:
-		meta.level = metaLevelKubernetes
-		meta.kubernetes = name
-		return meta
+// level returns the hierarchy level of the namespace or nil for the root
+func (t *Namespace) level() *HierarchyLevel {
+	if t.depth() == 0 {
+		return nil
 	}
-
-	panic("depth recursion limit exceeded")
+	return t.hierarchy[t.depth()-1]
 }
 
 // Sanatize iterates all of the configurations and configures the subject based on
 // the location within the directory strucutre and writes the file back to disk in
-// the same location as the original. Note that this function is recursive.
+// the same location as the original. The original of each changed file is kept and the
+// run is recorded in the manifest so that it can be restored with Restore. The manifest is
+// updated as each file is backed up so that a run that is interrupted can still be
+// restored. Each file is replaced atomically and if any file fails every file already
+// changed by the run is rolled back. Note that this function is recursive.
 func (t *Namespace) Sanatize() error {
 
 	var errors *multierror.Error
 
-	for _, x := range t.childMap {
-		if err := x.Sanatize(); err != nil {
+	manifest, err := LoadManifest(t.rootNamespace.path)
+	if err != nil {
+		return err
+	}
+
+	run := manifest.newRun()
+	manifest.Runs = append(manifest.Runs, run)
+
+	var changed []*file
+
+	for _, x := range t.files() {
+
+		written, err := x.sanatize(manifest, run)
+		if written {
+			changed = append(changed, x)
+		}
+
+		if err != nil {
+			errors = multierror.Append(errors, err)
+			break
+		}
+	}
+
+	if errors.ErrorOrNil() == nil && len(changed) > 0 {
+
+		if t.verbose {
+			log.Printf("recording run \"%s\" in manifest", run.ID)
+		}
+
+		run.InProgress = false
+
+		if err := manifest.save(t.rootNamespace.path); err != nil {
 			errors = multierror.Append(errors, err)
 		}
 	}
 
-	// Root does not have any files!
-	if t.level != metaLevelRoot {
-		for _, x := range t.fileMap {
-			if err := x.sanatize(); err != nil {
+	if errors.ErrorOrNil() != nil && len(run.Files) > 0 {
+		if err := t.rollback(run, changed); err != nil {
+			errors = multierror.Append(errors, err)
+		} else {
+			// The backups are gone so the run can no longer be restored
+			manifest.removeRun(run)
+			if err := manifest.save(t.rootNamespace.path); err != nil {
 				errors = multierror.Append(errors, err)
 			}
 		}
 	}
 
-	if t.restore != "" {
-		restoreFile := t.path + "/restore.sh"
+	return errors.ErrorOrNil()
+}
 
-		if t.verbose {
-			log.Printf("writing restore file \"%s\"", restoreFile)
+// SanatizeDryRun makes the same changes as Sanatize but only in memory; nothing is written to
+// disk. For each file that would change a unified diff is written to w followed by a summary
+// count. The number of files that would change is returned.
+func (t *Namespace) SanatizeDryRun(w io.Writer) (int, error) {
+
+	var errors *multierror.Error
+
+	files := t.files()
+	changed := 0
+
+	for _, x := range files {
+
+		if x.prismaConfig == nil || !x.sanatizeConfig() {
+			continue
 		}
 
-		if err := ioutil.WriteFile(restoreFile, []byte(restoreScript+t.restore), os.ModePerm); err != nil {
+		data, err := x.render()
+		if err != nil {
 			errors = multierror.Append(errors, err)
+			continue
+		}
+
+		if _, err := fmt.Fprint(w, unifiedDiff("a/"+x.rpath, "b/"+x.rpath, string(x.original), string(data))); err != nil {
+			return changed, err
 		}
+
+		changed++
 	}
 
-	return errors.ErrorOrNil()
+	if _, err := fmt.Fprintf(w, "%d of %d files would be changed\n", changed, len(files)); err != nil {
+		return changed, err
+	}
+
+	return changed, errors.ErrorOrNil()
+}
+
+// files returns every file in this namespace and below sorted by path
+func (t *Namespace) files() []*file {
+
+	var files []*file
+
+	for _, x := range t.childMap {
+		files = append(files, x.files()...)
+	}
+
+	for _, x := range t.fileMap {
+		files = append(files, x)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+
+	return files
 }
 
 // Validate verifies that the policy objects reference valid subjects. For example
 // if a policy subject is group=a, cloud=b, tenant=c and no subject with those tags
-// exist then an error will we returned. Errors are collated. Note that this function is
-// recursive.
+// exist then an error will we returned. Errors are collated. This is a wrapper around
+// ValidateFindings for callers that only need an error; warnings are not returned.
 func (t *Namespace) Validate() error {
+	return t.ValidateFindings().Unsuppressed().WithSeverity(SeverityError).ErrorOrNil()
+}
 
-	var errors *multierror.Error
+// ValidateFindings verifies that the policy objects reference valid subjects and returns
+// each problem as a Finding. Findings are collated. Note that this function is recursive.
+func (t *Namespace) ValidateFindings() Findings {
+
+	var findings Findings
 
 	for _, meta := range t.childMap {
-		if err := meta.Validate(); err != nil {
-			errors = multierror.Append(errors, err)
-		}
+		findings = append(findings, meta.ValidateFindings()...)
 	}
 
 	for _, meta := range t.fileMap {
-		if err := meta.validate(); err != nil {
-			errors = multierror.Append(errors, err)
-		}
+		findings = append(findings, meta.validate()...)
 	}
 
-	return errors.ErrorOrNil()
+	return findings
 }
 
 // This call is made for each matching configuration file found in any
@@ -235,7 +327,7 @@ func (t *Namespace) read() error {
 
 		if file.IsDir() {
 
-			if fileName == ".original" {
+			if fileName == originalDir {
 				if t.verbose {
 					log.Printf("ignoring directory \"%s\"", t.path+"/"+fileName)
 				}
@@ -244,7 +336,7 @@ func (t *Namespace) read() error {
 
 			log.Printf("loading directory \"%s\"", t.path+"/"+fileName)
 
-			if t.level == metaLevelKubernetes {
+			if t.depth() >= len(t.hierarchy) {
 				errors = multierror.Append(errors, fmt.Errorf("Directory \"%s\" has child directories; this is not valid", t.path+"/"+fileName))
 				continue
 			}
@@ -258,9 +350,15 @@ func (t *Namespace) read() error {
 
 		} else {
 
-			if extensionCheck(fileName) {
+			if fileName == LintConfigFilename {
+
+				if t.verbose {
+					log.Printf("ignoring lint config \"%s\"", t.path+"/"+fileName)
+				}
+
+			} else if extensionCheck(fileName) {
 
-				if t.level == metaLevelRoot {
+				if t.depth() == 0 {
 					log.Printf("file \"%s\" should NOT exist here", fileName)
 					errors = multierror.Append(errors, fmt.Errorf("File \"%s\" exist in root directory; this is not valid", t.path+"/"+fileName))
 
@@ -290,14 +388,14 @@ func (t *Namespace) read() error {
 	return errors.ErrorOrNil()
 }
 
-func (t *Namespace) addRestore(original, new string) {
-	t.restore = t.restore + fmt.Sprintf("cp %s %s\n", original, new)
-}
-
 // This takes in a string and returns two strings using the '=' character as the split
-// If there is no '=' char then an empty value will be returned
+// If there is no '=' char then an empty value will be returned. The key of a negated
+// tag such as "key!=value" is returned without the '!'.
 func keyValueSplit(keyValuePair string) (string, string) {
-	split := strings.Split(keyValuePair, "=")
+	if tag, err := prisma.ParseTag(keyValuePair); err == nil {
+		return tag.Key, tag.Value
+	}
+	split := strings.SplitN(keyValuePair, "=", 2)
 	key := split[0]
 	value := ""
 	if len(split) > 1 {
@@ -309,165 +407,242 @@ func keyValueSplit(keyValuePair string) (string, string) {
 
 // this verifies that the policy objects reference valid subjects. For example
 // if a policy subject is group=a, cloud=b, tenant=c and no subject with those tags
-// exist then an error will we returned. Errors are collated. This is called by the
-// Namespace when the Validate() function is called.
-func (t *file) validate() error {
+// exist then a finding will we returned. Findings are collated. This is called by the
+// Namespace when the ValidateFindings() function is called.
+func (t *file) validate() Findings {
 
 	if t.prismaConfig == nil {
-		return fmt.Errorf("missing prismaConfig in file %s", t.path)
+		return Findings{t.newFinding(RuleIDConfigMissing, "missing prismaConfig in file %s", t.path)}
 	}
 
 	if t.prismaConfig.Data == nil {
-		return fmt.Errorf("missing prismaConfig.Data in file %s", t.path)
+		return Findings{t.newFinding(RuleIDConfigMissing, "missing prismaConfig.Data in file %s", t.path)}
 	}
 
-	var errors *multierror.Error
+	var findings Findings
 
 	top := t.parent.rootNamespace.path
 
-	tenantCheck := func(rule, tenant string) *Namespace {
+	// policy and direction are set as each rule is iterated so that the findings
+	// can be attributed. objectPath is the path of the current object entry in the
+	// YAML document and tagIndex is the index of each tag key within that entry.
+	policy := ""
+	direction := ""
+	var ruleset *prisma.Networkrulesetpolicy
+	var objectPath []interface{}
+	var tagIndex map[string]int
 
-		if tenant == "" {
-			errors = multierror.Append(errors, fmt.Errorf("subject %s does not have a tenant tag in file \"%s\"", rule, t.path))
-			return nil
-		}
+	addFinding := func(ruleID RuleID, tag string, path []interface{}, format string, args ...interface{}) {
+		finding := t.newFinding(ruleID, format, args...)
+		finding.Policy = policy
+		finding.Direction = direction
+		finding.Tag = tag
+		t.setPosition(finding, path...)
+		findings = append(findings, finding)
+	}
 
-		ns := t.parent.rootNamespace.childMap[tenant]
-		if ns == nil {
-			errors = multierror.Append(errors, fmt.Errorf("subject %s in file \"%s\" references non existent tenant namespace %s", rule, t.path, top+"/"+tenant))
+	// tagPath returns the path of the tag with the specified key in the current object
+	tagPath := func(key string) []interface{} {
+		if i, ok := tagIndex[key]; ok {
+			return append(append([]interface{}{}, objectPath...), i)
 		}
-		return ns
+		return objectPath
 	}
 
-	cloudCheck := func(rule, tenant, cloud string) *Namespace {
+	hierarchy := t.parent.hierarchy
 
-		parentNS := tenantCheck(rule, tenant)
-		if parentNS == nil {
-			return nil
-		}
+	// This function walks the namespace tree from the root following values. Each value
+	// corresponds to a level of the hierarchy. The walk stops at the deepest level that is
+	// set. A level that is not set above it or a namespace that does not exist is reported.
+	nsCheck := func(values []string) {
 
-		if cloud == "" {
-			errors = multierror.Append(errors, fmt.Errorf("subject %s does not have a cloud tag in file \"%s\"", rule, t.path))
-			return nil
+		deepest := 0
+		for i, value := range values {
+			if value != "" {
+				deepest = i
+			}
 		}
 
-		ns := parentNS.childMap[cloud]
-		if ns == nil {
-			errors = multierror.Append(errors, fmt.Errorf("subject %s in file \"%s\" references non existent cloud namespace %s/%s", rule, t.path, top+"/"+tenant, cloud))
-		}
-		return ns
-	}
+		ns := t.parent.rootNamespace
 
-	groupCheck := func(rule, tenant, cloud, group string) *Namespace {
+		for i := 0; i <= deepest; i++ {
 
-		parentNS := cloudCheck(rule, tenant, cloud)
-		if parentNS == nil {
-			return nil
-		}
+			level := hierarchy[i]
 
-		if group == "" {
-			errors = multierror.Append(errors, fmt.Errorf("subject %s does not have a group tag in file \"%s\"", rule, t.path))
-			return nil
-		}
+			if values[i] == "" {
+				addFinding(missingTagRuleID(level.Name), level.TagKey, objectPath, "subject %s does not have a %s tag in file \"%s\"", direction, level.Name, t.path)
+				return
+			}
 
-		ns := parentNS.childMap[group]
-		if ns == nil {
-			errors = multierror.Append(errors, fmt.Errorf("subject %s in file \"%s\" references non existent group namespace %s/%s/%s", rule, t.path, top+"/"+tenant, cloud, group))
+			ns = ns.childMap[values[i]]
+			if ns == nil {
+				addFinding(RuleIDNamespaceNotFound, level.TagKey+"="+values[i], tagPath(level.TagKey), "subject %s in file \"%s\" references non existent %s namespace %s", direction, t.path, level.Name, top+"/"+strings.Join(values[:i+1], "/"))
+				return
+			}
 		}
-		return ns
 	}
 
-	kubernetesCheck := func(rule, tenant, cloud, group, kubernetes string) {
+	externalnetworkTagKeys := t.parent.rootNamespace.externalnetworkTagKeys()
+	visibleExternalnetworks := t.parent.visibleExternalnetworks()
 
-		parentNS := groupCheck(rule, tenant, cloud, group)
-		if parentNS == nil {
-			return
-		}
+	// This function verifies that an object selecting external networks matches at least one
+	// external network that is visible from this namespace
+	externalnetworkCheck := func(object []string) {
 
-		if kubernetes == "" {
-			errors = multierror.Append(errors, fmt.Errorf("subject %s does not have a kubernetes tag in file \"%s\"", rule, t.path))
-			return
+		for _, externalnetwork := range visibleExternalnetworks {
+			if externalnetworkMatches(externalnetwork, object) {
+				return
+			}
 		}
 
-		ns := parentNS.childMap[kubernetes]
-		if ns == nil {
-			errors = multierror.Append(errors, fmt.Errorf("subject %s in file \"%s\" references non existent kubernetes namespace %s/%s/%s/%s", rule, t.path, top+"/"+tenant, cloud, group, kubernetes))
+		tag := ""
+		for _, x := range object {
+			if x != externalnetworkIdentityTag {
+				tag = x
+				break
+			}
 		}
-	}
 
-	nsCheck := func(rule, tenant, cloud, group, kubernetes string) {
+		addFinding(RuleIDExternalNetworkNotFound, tag, objectPath, "subject %s in file \"%s\" references external network %s which does not exist or is not visible from namespace %s", direction, t.path, strings.Join(object, " "), t.parent.rpath)
+	}
 
-		if kubernetes != "" {
-			kubernetesCheck(rule, tenant, cloud, group, kubernetes)
-			return
-		}
+	// This function verifies that every object references valid subjects.
+	objectCheck := func(object []string) {
 
-		if group != "" {
-			groupCheck(rule, tenant, cloud, group)
-			return
+		for i, x := range object {
+			if _, err := prisma.ParseTag(x); err != nil {
+				addFinding(RuleIDTagInvalid, x, append(append([]interface{}{}, objectPath...), i), "subject %s in file \"%s\" has an invalid tag: %s", direction, t.path, err.Error())
+				return
+			}
 		}
 
-		if cloud != "" {
-			cloudCheck(rule, tenant, cloud)
+		if isExternalnetworkSelector(object, hierarchy, externalnetworkTagKeys) {
+			externalnetworkCheck(object)
 			return
 		}
 
-		tenantCheck(rule, tenant)
-	}
-
-	// This function verifies that every object references valid subjects.
-	objectCheck := func(rule string, object []string) {
+		tagIndex = make(map[string]int)
 
-		tenant := ""
-		cloud := ""
-		group := ""
-		kubernetes := ""
-
-		// Note the hiearchy is tenant->cloud->group->kubernetes
+		// Note the hiearchy is defined by the Hierarchy; by default tenant->cloud->group->kubernetes
 		// The tags may be in any order so we iterate them and pick out the ones we care about
 		// (those just listed). The rules are as follows:
-		// 1) The tag with the key 'tenant' MUST always be present
+		// 1) The tag with the key of the top level (by default 'tenant') MUST always be present
 		// 2) If any other tag is present its hiearchial parent MUST also be present. For example if
 		// 'group' is set then 'cloud' must also be set.
 
-		for _, keyValuePair := range object {
+		for i, keyValuePair := range object {
+			key, _ := keyValueSplit(keyValuePair)
+			tagIndex[key] = i
+		}
 
-			key, value := keyValueSplit(keyValuePair)
+		nsCheck(hierarchy.values(object))
+	}
 
-			switch key {
+	// This function verifies that each protocol port of a rule is valid and does not overlap
+	// another protocol port of the same rule. The rulePath is the path of the rule in the
+	// YAML document.
+	protocolPortCheck := func(rulePath []interface{}, protocolPorts []string) {
 
-			case "@org:tenant":
-				tenant = value
+		var parsed []*prisma.ProtocolPort
+		var parsedIndex []int
 
-			case "@org:cloudaccount":
-				cloud = value
+		for i, x := range protocolPorts {
 
-			case "@org:group":
-				group = value
+			path := append(append([]interface{}{}, rulePath...), "protocolPorts", i)
 
-			case "@org:kubernetes":
-				kubernetes = value
+			protocolPort, err := prisma.ParseProtocolPort(x)
+			if err != nil {
+				ruleID := RuleIDProtocolPortInvalid
+				if errors.Is(err, prisma.ErrProtocolPortRange) {
+					ruleID = RuleIDProtocolPortOutOfRange
+				}
+				addFinding(ruleID, x, path, "subject %s in file \"%s\" has an invalid protocol port: %s", direction, t.path, err.Error())
+				continue
+			}
 
+			for j, other := range parsed {
+				if protocolPort.Overlaps(other) {
+					addFinding(RuleIDProtocolPortOverlap, x, path, "subject %s in file \"%s\" has protocol port %s which overlaps %s", direction, t.path, x, protocolPorts[parsedIndex[j]])
+					break
+				}
 			}
 
+			parsed = append(parsed, protocolPort)
+			parsedIndex = append(parsedIndex, i)
+		}
+	}
+
+	// This function verifies that an outgoing Allow rule to a namespace in the tree is
+	// accepted by an incoming Allow rule of a ruleset in that namespace. Objects that do
+	// not resolve to a namespace are reported by objectCheck.
+	flowCheck := func(rule *prisma.Rule, object []string) {
+
+		if direction != "OutgoingRules" || rule.Action != prisma.TrafficActionAllow {
+			return
+		}
+
+		if isExternalnetworkSelector(object, hierarchy, externalnetworkTagKeys) {
+			return
+		}
+
+		target := t.parent.lookup(hierarchy.values(object))
+		if target == nil {
+			return
+		}
+
+		protocolPorts, err := rule.ParsedProtocolPorts()
+		if err != nil {
+			return
 		}
 
-		nsCheck(rule, tenant, cloud, group, kubernetes)
+		clause, err := prisma.ParseTagClause(object)
+		if err != nil {
+			return
+		}
+
+		source, err := prisma.ParseTagExpression(t.parent.subjectTags(ruleset))
+		if err != nil {
+			return
+		}
+
+		if !flowAccepted(target, clause, source, protocolPorts) {
+			var ports []string
+			for _, x := range protocolPorts {
+				ports = append(ports, x.String())
+			}
+			addFinding(RuleIDFlowOneSided, "", objectPath, "subject %s in file \"%s\" allows %s to %s but no ruleset in namespace %s accepts it", direction, t.path, strings.Join(ports, ","), strings.Join(object, " "), target.rpath)
+		}
 	}
 
-	// This function verifies that each rules object references valid subjects.
-	ruleCheck := func(rule string, rules []*prisma.Rule) {
+	// This function verifies that each rules object references valid subjects. The
+	// rulesPath is the path of the rules in the YAML document.
+	ruleCheck := func(rulesPath []interface{}, rules []*prisma.Rule) {
 
-		for _, rules := range rules {
+		for i, rules := range rules {
+			protocolPortCheck(append(append([]interface{}{}, rulesPath...), i), rules.ProtocolPorts)
 			if rules.Object == nil || len(rules.Object) <= 0 {
-				log.Printf("there are no OutgoingRules in file \"%s\"", t.path)
+				log.Printf("there are no %s in file \"%s\"", direction, t.path)
 			} else {
-				for _, object := range rules.Object {
-					objectCheck(rule, object)
+				for j, object := range rules.Object {
+					objectPath = append(append([]interface{}{}, rulesPath...), i, "object", j)
+					objectCheck(object)
+					flowCheck(rules, object)
 				}
 			}
 		}
 
+		for _, x := range ruleConflicts(rules, hierarchy.exclusive) {
+			path := append(append([]interface{}{}, rulesPath...), x.index)
+			switch x.ruleID {
+			case RuleIDRuleDuplicate:
+				addFinding(x.ruleID, "", path, "subject %s rule %d in file \"%s\" is a duplicate of rule %d", direction, x.index, t.path, x.other)
+			case RuleIDRuleShadowed:
+				addFinding(x.ruleID, "", path, "subject %s rule %d in file \"%s\" can never take effect as it is covered by Reject rule %d", direction, x.index, t.path, x.other)
+			default:
+				addFinding(x.ruleID, "", path, "subject %s rule %d in file \"%s\" is redundant as it is covered by rule %d", direction, x.index, t.path, x.other)
+			}
+		}
+
 	}
 
 	if t.prismaConfig.Data.Networkrulesetpolicies == nil || len(t.prismaConfig.Data.Networkrulesetpolicies) <= 0 {
@@ -476,35 +651,89 @@ func (t *file) validate() error {
 
 		log.Printf("processing Networkrulesetpolicies in file \"%s\"", t.path)
 
-		for _, ruleset := range t.prismaConfig.Data.Networkrulesetpolicies {
+		for i := range t.prismaConfig.Data.Networkrulesetpolicies {
+
+			ruleset = t.prismaConfig.Data.Networkrulesetpolicies[i]
 
 			if ruleset == nil {
 				log.Printf("there are no rules in file \"%s\"", t.path)
 			} else {
-				ruleCheck("OutgoingRules", ruleset.OutgoingRules)
-				ruleCheck("IncomingRules", ruleset.IncomingRules)
+				start := len(findings)
+				policy = ruleset.Name
+				direction = "OutgoingRules"
+				ruleCheck([]interface{}{"data", "networkrulesetpolicies", i, "outgoingRules"}, ruleset.OutgoingRules)
+				direction = "IncomingRules"
+				ruleCheck([]interface{}{"data", "networkrulesetpolicies", i, "incomingRules"}, ruleset.IncomingRules)
+				findings = append(findings, t.suppress(findings[start:], ruleset.Annotations, ruleset.Name, []interface{}{"data", "networkrulesetpolicies", i, "annotations"})...)
 			}
 
 		}
 
 	}
 
+	policy = ""
+	direction = ""
+
+	for i, externalnetwork := range t.prismaConfig.Data.Externalnetworks {
+		if externalnetwork != nil {
+			externalnetworkFindings := t.externalnetworkCheck(i, externalnetwork)
+			findings = append(findings, externalnetworkFindings...)
+			findings = append(findings, t.suppress(externalnetworkFindings, externalnetwork.Annotations, externalnetwork.Name, []interface{}{"data", "externalnetworks", i, "annotations"})...)
+		}
+	}
+
 	if t.prismaConfig.Label != t.label {
-		errors = multierror.Append(errors, fmt.Errorf("label \"%s\" should be \"%s\" in file \"%s\"", t.prismaConfig.Label, t.label, t.path))
+		addFinding(RuleIDLabelMismatch, "", []interface{}{"label"}, "label \"%s\" should be \"%s\" in file \"%s\"", t.prismaConfig.Label, t.label, t.path)
 	}
 
-	return errors.ErrorOrNil()
+	return findings
 }
 
 // This iterates the prisma config and configures the subject based on
 // the location within the directory strucutre and writes the file back to disk in
-// the same location as the original. This function is used by the Namespace func Sanatize
-func (t *file) sanatize() error {
+// the same location as the original. The original is backed up and recorded in the
+// run. Returns true if the file was written. This function is used by the Namespace
+// func Sanatize
+func (t *file) sanatize(manifest *Manifest, run *ManifestRun) (bool, error) {
+
+	if t.prismaConfig == nil {
+		return false, nil
+	}
+
+	if !t.sanatizeConfig() {
+		if t.parent.verbose {
+			log.Printf("no change to file \"%s\"", t.path)
+		}
+		return false, nil
+	}
+
+	data, err := t.render()
+	if err != nil {
+		return false, err
+	}
+
+	if err := t.backup(manifest, run, data); err != nil {
+		return false, err
+	}
+
+	if err := writeFileAtomic(t.path, data, 0644); err != nil {
+		return false, fmt.Errorf("failed to write file %s : %w", t.path, err)
+	}
+	log.Printf("file \"%s\" updated", t.path)
+
+	return true, nil
+}
+
+// This configures the subject of each Networkrulesetpolicy and the label based on the location
+// within the directory structure. Both the decoded config and the YAML node tree are updated
+// so that the file can be written back with its comments and formatting intact. Only the
+// nodes that actually change are touched. Returns true if anything changed.
+func (t *file) sanatizeConfig() bool {
 
 	// Subject
 	// 1) Flatten the subject from [][]string to []string
-	// 2) Remove any tags with the the key prefix of '@org'
-	// 3) Add in the '@org' entries based on the current level
+	// 2) Remove any tags with the the key prefix of '@org' or the key of a hierarchy level
+	// 3) Add in the hierarchy entries based on the current level
 
 	// - - "@org:cloudaccount="
 	//   - "@org:group={{.Values.org.group}}"
@@ -513,81 +742,51 @@ func (t *file) sanatize() error {
 	//   - app=backend
 
 	if t.prismaConfig == nil {
-		return nil
+		return false
 	}
 
-	ruleSetHash := func(policies []*prisma.Networkrulesetpolicy) string {
-
-		result := ""
-		for _, ruleset := range policies {
-			result = result + ruleset.String()
-		}
-
-		return result
+	if t.prismaConfig.Data == nil {
+		t.prismaConfig.Data = &prisma.Data{}
 	}
 
-	preRuleSetPolicyString := ruleSetHash(t.prismaConfig.Data.Networkrulesetpolicies)
+	hierarchy := t.parent.hierarchy
 
-	for _, ruleset := range t.prismaConfig.Data.Networkrulesetpolicies {
-
-		var newSubs []string
-
-		addTenant := func() {
-			newSubs = append(newSubs, "@org:tenant="+t.parent.tenant)
-		}
+	dirty := false
 
-		addCloud := func() {
-			addTenant()
-			newSubs = append(newSubs, "@org:cloudaccount="+t.parent.cloud)
-		}
+	for i, ruleset := range t.prismaConfig.Data.Networkrulesetpolicies {
 
-		addGroup := func() {
-			addCloud()
-			newSubs = append(newSubs, "@org:group="+t.parent.group)
+		if ruleset == nil {
+			continue
 		}
 
-		addKubernetes := func() {
-			addGroup()
-			newSubs = append(newSubs, "@org:kubernetes="+t.parent.kubernetes)
-		}
+		var newSubs []string
 
 		for _, subject := range ruleset.Subject {
 			for _, sub := range subject {
-				if !strings.HasPrefix(sub, "@org:") {
+				if !hierarchy.isHierarchyTag(sub) {
 					newSubs = append(newSubs, sub)
 				}
 			}
 		}
 
-		switch t.parent.level {
-
-		case metaLevelTenant:
-			addTenant()
+		newSubs = append(newSubs, hierarchy.tags(t.parent.values)...)
 
-		case metaLevelCloud:
-			addCloud()
-
-		case metaLevelGroup:
-			addGroup()
+		if len(ruleset.Subject) == 1 && stringsEqual(ruleset.Subject[0], newSubs) {
+			continue
+		}
 
-		case metaLevelKubernetes:
-			addKubernetes()
+		ruleset.Subject = [][]string{newSubs}
 
+		if policyNode := nodeLookup(t.node, "data", "networkrulesetpolicies", i); policyNode != nil {
+			t.edits = append(t.edits, newNodeEdit(policyNode, "subject"))
+			nodeSetMappingValue(policyNode, "subject", newSubjectNode(nodeMappingValue(policyNode, "subject"), newSubs, hierarchy.isHierarchyTag))
 		}
 
-		var newSubSubs [][]string
-		newSubSubs = append(newSubSubs, newSubs)
-
-		ruleset.Subject = newSubSubs
+		dirty = true
 	}
 
-	dirty := false
-
-	postRuleSetPolicyString := ruleSetHash(t.prismaConfig.Data.Networkrulesetpolicies)
-
-	if preRuleSetPolicyString != postRuleSetPolicyString {
+	if dirty {
 		log.Printf("tags updated in file \"%s\"", t.path)
-		dirty = true
 	} else {
 		if t.parent.verbose {
 			log.Printf("no changes to tags updated file \"%s\"", t.path)
@@ -598,6 +797,10 @@ func (t *file) sanatize() error {
 
 	if oldLabel != t.label {
 		t.prismaConfig.Label = t.label
+		if root := nodeResolve(t.node); root != nil {
+			t.edits = append(t.edits, newNodeEdit(root, "label"))
+			nodeSetMappingValue(root, "label", newStringNode(nodeMappingValue(root, "label"), t.label))
+		}
 		log.Printf("label changed from \"%s\" to \"%s\" in file \"%s\"", oldLabel, t.label, t.path)
 		dirty = true
 	} else {
@@ -606,46 +809,89 @@ func (t *file) sanatize() error {
 		}
 	}
 
-	//	filenameWithoutExt := strings.TrimRight(t.path, filepath.Ext(t.path))
+	return dirty
+}
 
-	if dirty {
+// This returns the YAML for the file. The changed entries are patched into the original so
+// that the rest of the file is kept byte for byte. If that is not possible, for example
+// because an entry was added, the whole node tree is encoded using the indentation of the
+// original file; comments are kept but the formatting may differ from the original. Each
+// result is parsed back and only used if it decodes to the config. If neither does, for
+// example because an alias refers to a changed entry, the config is encoded on its own and
+// the comments are lost.
+func (t *file) render() ([]byte, error) {
 
-		originalDirPath := t.parent.path + "/.original"
-		originalDirRPath := t.parent.rpath + "/.original"
+	if nodeResolve(t.node) == nil {
+		return yaml.Marshal(&t.prismaConfig)
+	}
 
-		if err := os.MkdirAll(originalDirPath, os.ModePerm); err != nil {
-			return err
-		}
+	if data, ok := nodePatch(t.original, t.edits, nodeIndent(t.node)); ok && t.decodesTo(data) {
+		return data, nil
+	}
 
-		originalFilePath := originalDirPath + "/" + t.filename
-		originalFileRPath := originalDirRPath + "/" + t.filename
+	var buf bytes.Buffer
 
-		if err := os.Rename(t.path, originalFilePath); err != nil {
-			return fmt.Errorf("failed to rename file %s to %s: %w", t.path, originalFilePath, err)
-		}
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(nodeIndent(t.node))
 
-		t.parent.rootNamespace.addRestore(originalFileRPath, t.rpath)
+	if err := encoder.Encode(t.node); err != nil {
+		return nil, fmt.Errorf("failed to encode file %s : %w", t.path, err)
+	}
 
-		// if err := os.Rename(t.path, filenameWithoutExt+".backup"); err != nil {
-		// 	return fmt.Errorf("failed to rename file %s : %w", t.path, err)
-		// }
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode file %s : %w", t.path, err)
+	}
 
-		data, err := yaml.Marshal(&t.prismaConfig)
-		if err != nil {
-			return err
-		}
+	if t.decodesTo(buf.Bytes()) {
+		return buf.Bytes(), nil
+	}
 
-		if err := ioutil.WriteFile(t.path, data, 0644); err != nil {
-			return fmt.Errorf("failed to write file %s : %w", t.path, err)
-		}
-		log.Printf("file \"%s\" updated", t.path)
-	} else {
-		if t.parent.verbose {
-			log.Printf("no change to file \"%s\"", t.path)
+	log.Printf("comments in file \"%s\" can not be kept", t.path)
+
+	return yaml.Marshal(&t.prismaConfig)
+}
+
+// decodesTo returns true if data decodes to the config of the file
+func (t *file) decodesTo(data []byte) bool {
+
+	var config *prisma.Config
+	if err := yaml.Unmarshal(data, &config); err != nil || config == nil {
+		return false
+	}
+
+	// sanatizeConfig adds empty data to a config without any
+	if config.Data == nil && t.prismaConfig.Data != nil {
+		config.Data = &prisma.Data{}
+	}
+
+	// Both are encoded so that empty and missing lists compare equal
+	a, err := yaml.Marshal(config)
+	if err != nil {
+		return false
+	}
+
+	b, err := yaml.Marshal(t.prismaConfig)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(a, b)
+}
+
+// stringsEqual returns true if a and b contain the same strings in the same order
+func stringsEqual(a, b []string) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
 	}
 
-	return nil
+	return true
 }
 
 // this loads a prisma config file into the file
@@ -656,8 +902,23 @@ func (t *file) load() error {
 		return err
 	}
 
-	if err := yaml.Unmarshal(b, &t.prismaConfig); err != nil {
-		return err
+	t.original = b
+
+	// We keep the node tree so that findings can reference the position of the
+	// offending entry in the file
+	node := &yaml.Node{}
+	if err := yaml.Unmarshal(b, node); err != nil {
+		return fmt.Errorf("failed to parse file %s : %w", t.path, err)
+	}
+	t.node = node
+
+	// An empty file has no content and is left without a config
+	if len(node.Content) == 0 {
+		return nil
+	}
+
+	if err := node.Decode(&t.prismaConfig); err != nil {
+		return fmt.Errorf("failed to decode file %s : %w", t.path, err)
 	}
 
 	return nil
@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// QueryMatch is a rule that matched a query
+type QueryMatch struct {
+	Path      string               `json:"path" yaml:"path"`
+	Policy    string               `json:"policy" yaml:"policy"`
+	Direction string               `json:"direction" yaml:"direction"`
+	Index     int                  `json:"index" yaml:"index"`
+	Action    prisma.TrafficAction `json:"action" yaml:"action"`
+}
+
+func (t *QueryMatch) String() string {
+	return fmt.Sprintf("%s %s rule %d of policy %s in file \"%s\"", t.Action, t.Direction, t.Index, t.Policy, t.Path)
+}
+
+// QueryDecision is the decision for one side of a flow. Matches are the rules that decided it;
+// the Reject rules if any matched, otherwise the Allow rules. If no rule matched the traffic is
+// denied and Matches is empty.
+type QueryDecision struct {
+	Allowed bool          `json:"allowed" yaml:"allowed"`
+	Matches []*QueryMatch `json:"matches,omitempty" yaml:"matches,omitempty"`
+}
+
+// QueryResult is the result of a Query. Traffic is allowed only if the source allows it
+// outgoing and the destination allows it incoming.
+type QueryResult struct {
+	Allowed  bool           `json:"allowed" yaml:"allowed"`
+	Outgoing *QueryDecision `json:"outgoing" yaml:"outgoing"`
+	Incoming *QueryDecision `json:"incoming" yaml:"incoming"`
+}
+
+// Query evaluates whether a workload with the source tags can reach a workload with the
+// destination tags on the protocol port. Each tag set must include the hierarchy tags of a
+// namespace in the tree; the hierarchy tags of the namespace are added to the tag set. A
+// rule matches if one of its protocol ports contains the protocol port of the query. Reject
+// takes precedence over Allow and traffic that no rule matches is denied. Subjects and
+// objects are matched with prisma.TagExpression so wildcards and negation are supported.
+func (t *Namespace) Query(source, destination []string, protocolPort string) (*QueryResult, error) {
+
+	queryPort, err := prisma.ParseProtocolPort(protocolPort)
+	if err != nil {
+		return nil, err
+	}
+
+	workload := func(name string, tags []string) (*Namespace, prisma.TagSet, error) {
+		ns := t.rootNamespace.lookup(t.hierarchy.values(tags))
+		if ns == nil {
+			return nil, nil, fmt.Errorf("%s tags %v do not identify a namespace in the tree", name, tags)
+		}
+		return ns, prisma.NewTagSet(append(append([]string{}, tags...), t.hierarchy.tags(ns.values)...)), nil
+	}
+
+	sourceNamespace, sourceTags, err := workload("source", source)
+	if err != nil {
+		return nil, err
+	}
+
+	destinationNamespace, destinationTags, err := workload("destination", destination)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{
+		Outgoing: sourceNamespace.decide("OutgoingRules", sourceTags, destinationTags, queryPort),
+		Incoming: destinationNamespace.decide("IncomingRules", destinationTags, sourceTags, queryPort),
+	}
+
+	result.Allowed = result.Outgoing.Allowed && result.Incoming.Allowed
+
+	return result, nil
+}
+
+// decide evaluates the rules in the direction of every ruleset that applies to the subject
+// workload in this namespace against the object workload. Subjects and objects with invalid
+// tags do not match.
+func (t *Namespace) decide(direction string, subject, object prisma.TagSet, protocolPort *prisma.ProtocolPort) *QueryDecision {
+
+	var allows, rejects []*QueryMatch
+
+	for _, x := range t.applicableRulesets() {
+
+		if len(x.ruleset.Subject) > 0 && !expressionMatches(x.ruleset.Subject, subject) {
+			continue
+		}
+
+		rules := x.ruleset.IncomingRules
+		if direction == "OutgoingRules" {
+			rules = x.ruleset.OutgoingRules
+		}
+
+		for i, rule := range rules {
+
+			if rule == nil || !expressionMatches(rule.Object, object) {
+				continue
+			}
+
+			protocolPorts, err := rule.ParsedProtocolPorts()
+			if err != nil {
+				continue
+			}
+
+			contained := false
+			for _, y := range protocolPorts {
+				if y.Contains(protocolPort) {
+					contained = true
+					break
+				}
+			}
+
+			if !contained {
+				continue
+			}
+
+			match := &QueryMatch{
+				Path:      x.file.path,
+				Policy:    x.ruleset.Name,
+				Direction: direction,
+				Index:     i,
+				Action:    rule.Action,
+			}
+
+			switch rule.Action {
+			case prisma.TrafficActionAllow:
+				allows = append(allows, match)
+			case prisma.TrafficActionReject:
+				rejects = append(rejects, match)
+			}
+		}
+	}
+
+	if len(rejects) > 0 {
+		return &QueryDecision{Matches: rejects}
+	}
+
+	return &QueryDecision{Allowed: len(allows) > 0, Matches: allows}
+}
+
+// expressionMatches returns true if the subject or object matches the workload tags. An
+// expression that can not be parsed does not match.
+func expressionMatches(expression [][]string, tags prisma.TagSet) bool {
+
+	x, err := prisma.ParseTagExpression(expression)
+	if err != nil {
+		return false
+	}
+
+	return x.Matches(tags)
+}
@@ -0,0 +1,261 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// originalDir is the directory below the root that holds the backups and manifest
+	originalDir = ".original"
+	// manifestFile is the name of the manifest inside originalDir
+	manifestFile = "manifest.json"
+	// runIDFormat is the time format used for the ID of each run
+	runIDFormat = "20060102T150405.000Z"
+)
+
+// Manifest records every Sanatize run so that the changes can be restored
+type Manifest struct {
+	Runs []*ManifestRun `json:"runs"`
+}
+
+// ManifestRun is a single Sanatize run. A run is saved before the first file is changed and
+// after each file is backed up; InProgress stays set if the run did not finish.
+type ManifestRun struct {
+	ID         string          `json:"id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	InProgress bool            `json:"inProgress,omitempty"`
+	Files      []*ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file that was changed by a Sanatize run. Paths are relative to the root.
+// The hashes are the hex encoded SHA256 of the file before and after the run.
+type ManifestFile struct {
+	Path         string `json:"path"`
+	Backup       string `json:"backup"`
+	OriginalHash string `json:"originalHash"`
+	NewHash      string `json:"newHash"`
+}
+
+func (t *Manifest) String() string {
+	s, _ := json.Marshal(t)
+	return string(s)
+}
+
+// Run returns the run with the specified ID. If id is empty the latest run is returned. If
+// the run does not exist nil is returned.
+func (t *Manifest) Run(id string) *ManifestRun {
+
+	if len(t.Runs) == 0 {
+		return nil
+	}
+
+	if id == "" {
+		return t.Runs[len(t.Runs)-1]
+	}
+
+	for _, x := range t.Runs {
+		if x.ID == id {
+			return x
+		}
+	}
+
+	return nil
+}
+
+// newRun returns a new run in progress with an ID based on the current time. The run is not
+// added to the manifest.
+func (t *Manifest) newRun() *ManifestRun {
+
+	now := time.Now().UTC()
+
+	run := &ManifestRun{
+		ID:         now.Format(runIDFormat),
+		Timestamp:  now,
+		InProgress: true,
+	}
+
+	// Runs made within the same millisecond would share an ID
+	for i := 1; t.Run(run.ID) != nil; i++ {
+		run.ID = fmt.Sprintf("%s-%d", now.Format(runIDFormat), i)
+	}
+
+	return run
+}
+
+// removeRun removes the run from the manifest
+func (t *Manifest) removeRun(run *ManifestRun) {
+
+	var runs []*ManifestRun
+
+	for _, x := range t.Runs {
+		if x != run {
+			runs = append(runs, x)
+		}
+	}
+
+	t.Runs = runs
+}
+
+// hashBytes returns the hex encoded SHA256 of b
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadManifest loads the manifest from the root directory path. If no Sanatize run has been
+// made an empty manifest is returned.
+func LoadManifest(path string) (*Manifest, error) {
+
+	manifest := &Manifest{}
+
+	b, err := ioutil.ReadFile(filepath.Join(path, originalDir, manifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest in %s : %w", path, err)
+	}
+
+	return manifest, nil
+}
+
+// save writes the manifest to the root directory path
+func (t *Manifest) save(path string) error {
+
+	if err := os.MkdirAll(filepath.Join(path, originalDir), os.ModePerm); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(path, originalDir, manifestFile), b, 0644)
+}
+
+// backup copies the original content of the file to the backup directory for the run and
+// records it in the run. The manifest is saved so that the backup is recorded before the
+// file is changed.
+func (t *file) backup(manifest *Manifest, run *ManifestRun, data []byte) error {
+
+	backupRPath := filepath.Join(originalDir, run.ID, t.rpath)
+	backupPath := filepath.Join(t.parent.rootNamespace.path, backupRPath)
+
+	if err := os.MkdirAll(filepath.Dir(backupPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(backupPath, t.original, 0644); err != nil {
+		return fmt.Errorf("failed to write backup %s : %w", backupPath, err)
+	}
+
+	run.Files = append(run.Files, &ManifestFile{
+		Path:         t.rpath,
+		Backup:       backupRPath,
+		OriginalHash: hashBytes(t.original),
+		NewHash:      hashBytes(data),
+	})
+
+	return manifest.save(t.parent.rootNamespace.path)
+}
+
+// Restore restores the files changed by a Sanatize run in the root directory path. If runID
+// is empty the latest run is used. If filename is set only that file (relative to path) is
+// restored. A file that has changed since the run is not restored; if any file has changed
+// nothing is restored and an error is returned.
+func Restore(path, runID, filename string, verbose bool) error {
+
+	manifest, err := LoadManifest(path)
+	if err != nil {
+		return err
+	}
+
+	run := manifest.Run(runID)
+	if run == nil {
+		if runID == "" {
+			return fmt.Errorf("there are no runs to restore in %s", path)
+		}
+		return fmt.Errorf("run %s does not exist in %s", runID, path)
+	}
+
+	if run.InProgress {
+		log.Printf("run \"%s\" did not finish; restoring the files it recorded", run.ID)
+	}
+
+	var files []*ManifestFile
+
+	for _, x := range run.Files {
+		if filename == "" || filepath.Clean(filename) == filepath.Clean(x.Path) {
+			files = append(files, x)
+		}
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("file %s was not changed by run %s", filename, run.ID)
+	}
+
+	// Verify everything before touching anything so that a run is never partially restored
+	pending := make(map[*ManifestFile][]byte)
+
+	for _, x := range files {
+
+		current, err := ioutil.ReadFile(filepath.Join(path, x.Path))
+		if err != nil {
+			return err
+		}
+
+		switch hashBytes(current) {
+
+		case x.NewHash:
+
+		case x.OriginalHash:
+			if verbose {
+				log.Printf("file \"%s\" is already restored", x.Path)
+			}
+			continue
+
+		default:
+			return fmt.Errorf("file %s has changed since run %s; refusing to restore", x.Path, run.ID)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(path, x.Backup))
+		if err != nil {
+			return err
+		}
+
+		if hashBytes(data) != x.OriginalHash {
+			return fmt.Errorf("backup %s does not match the manifest; refusing to restore", x.Backup)
+		}
+
+		pending[x] = data
+	}
+
+	for _, x := range files {
+
+		data, ok := pending[x]
+		if !ok {
+			continue
+		}
+
+		if err := writeFileAtomic(filepath.Join(path, x.Path), data, 0644); err != nil {
+			return fmt.Errorf("failed to restore file %s : %w", x.Path, err)
+		}
+
+		log.Printf("file \"%s\" restored from run \"%s\"", x.Path, run.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,472 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+// Risk is the risk classification of a Change. A change that allows more traffic is riskier
+// than one that allows less.
+type Risk string
+
+const (
+	// RiskHigh is a change that opens broad or previously rejected traffic
+	RiskHigh Risk = "high"
+	// RiskMedium is a change that opens traffic
+	RiskMedium Risk = "medium"
+	// RiskLow is a change that closes traffic or does not change what is allowed
+	RiskLow Risk = "low"
+)
+
+// rank returns the order of the risk; higher is riskier
+func (t Risk) rank() int {
+	switch t {
+	case RiskHigh:
+		return 2
+	case RiskMedium:
+		return 1
+	}
+	return 0
+}
+
+// ChangeKind is the kind of a Change
+type ChangeKind string
+
+const (
+	// ChangePolicyAdded is a ruleset that only exists in the new tree
+	ChangePolicyAdded ChangeKind = "policy-added"
+	// ChangePolicyRemoved is a ruleset that only exists in the old tree
+	ChangePolicyRemoved ChangeKind = "policy-removed"
+	// ChangePropagationEnabled is a ruleset that now propagates to the namespaces below
+	ChangePropagationEnabled ChangeKind = "propagation-enabled"
+	// ChangePropagationDisabled is a ruleset that no longer propagates
+	ChangePropagationDisabled ChangeKind = "propagation-disabled"
+	// ChangeSubjectBroadened is a subject that now matches more workloads
+	ChangeSubjectBroadened ChangeKind = "subject-broadened"
+	// ChangeSubjectNarrowed is a subject that now matches fewer workloads
+	ChangeSubjectNarrowed ChangeKind = "subject-narrowed"
+	// ChangeSubjectChanged is a subject that matches different workloads
+	ChangeSubjectChanged ChangeKind = "subject-changed"
+	// ChangeRuleAdded is a rule that only exists in the new tree
+	ChangeRuleAdded ChangeKind = "rule-added"
+	// ChangeRuleRemoved is a rule that only exists in the old tree
+	ChangeRuleRemoved ChangeKind = "rule-removed"
+	// ChangeActionAllowed is a rule whose action changed from Reject to Allow
+	ChangeActionAllowed ChangeKind = "action-allowed"
+	// ChangeActionRejected is a rule whose action changed from Allow to Reject
+	ChangeActionRejected ChangeKind = "action-rejected"
+	// ChangePortsWidened is a rule that now matches more protocol ports
+	ChangePortsWidened ChangeKind = "ports-widened"
+	// ChangePortsNarrowed is a rule that now matches fewer protocol ports
+	ChangePortsNarrowed ChangeKind = "ports-narrowed"
+	// ChangePortsChanged is a rule that matches different protocol ports
+	ChangePortsChanged ChangeKind = "ports-changed"
+	// ChangeObjectsBroadened is a rule whose objects now match more workloads
+	ChangeObjectsBroadened ChangeKind = "objects-broadened"
+	// ChangeObjectsNarrowed is a rule whose objects now match fewer workloads
+	ChangeObjectsNarrowed ChangeKind = "objects-narrowed"
+	// ChangeObjectsChanged is a rule whose objects match different workloads
+	ChangeObjectsChanged ChangeKind = "objects-changed"
+)
+
+// Change is a semantic change of a ruleset between two trees. Namespace is the relative path
+// of the namespace and Path is the file in the new tree, or the old tree if the ruleset was
+// removed.
+type Change struct {
+	Namespace string     `json:"namespace" yaml:"namespace"`
+	Path      string     `json:"path" yaml:"path"`
+	Policy    string     `json:"policy" yaml:"policy"`
+	Direction string     `json:"direction,omitempty" yaml:"direction,omitempty"`
+	Kind      ChangeKind `json:"kind" yaml:"kind"`
+	Risk      Risk       `json:"risk" yaml:"risk"`
+	Message   string     `json:"message" yaml:"message"`
+}
+
+func (t *Change) String() string {
+	return fmt.Sprintf("%s: %s [%s]", t.Risk, t.Message, t.Kind)
+}
+
+// semanticRule is a rule with its parsed objects and protocol ports and canonical keys used to
+// match rules between trees
+type semanticRule struct {
+	rule          *prisma.Rule
+	objects       prisma.TagExpression
+	protocolPorts []*prisma.ProtocolPort
+	objectsKey    string
+	portsKey      string
+	matched       bool
+}
+
+func newSemanticRule(rule *prisma.Rule) *semanticRule {
+
+	t := &semanticRule{rule: rule}
+
+	t.objects, _ = prisma.ParseTagExpression(rule.Object)
+	t.protocolPorts, _ = rule.ParsedProtocolPorts()
+
+	var clauses []string
+	for _, x := range rule.Object {
+		tags := append([]string{}, x...)
+		sort.Strings(tags)
+		clauses = append(clauses, strings.Join(tags, " "))
+	}
+	sort.Strings(clauses)
+	t.objectsKey = strings.Join(clauses, " OR ")
+
+	var ports []string
+	for _, x := range t.protocolPorts {
+		ports = append(ports, x.String())
+	}
+	sort.Strings(ports)
+	t.portsKey = strings.Join(ports, ",")
+
+	return t
+}
+
+// describe returns the rule in words, for example "Allow tcp/22 from app=web"
+func (t *semanticRule) describe(direction string) string {
+
+	preposition := "from"
+	if direction == "OutgoingRules" {
+		preposition = "to"
+	}
+
+	return fmt.Sprintf("%s %s %s %s", t.rule.Action, t.portsKey, preposition, t.objectsKey)
+}
+
+// broad returns true if the rule matches any protocol, every TCP or UDP port or an object that
+// selects a whole top level namespace or less specific
+func (t *semanticRule) broad(hierarchy Hierarchy) bool {
+
+	for _, x := range t.protocolPorts {
+		if x.Protocol == prisma.ProtocolAny {
+			return true
+		}
+		if (x.Protocol == prisma.ProtocolTCP || x.Protocol == prisma.ProtocolUDP) && x.FromPort == prisma.MinPort && x.ToPort == prisma.MaxPort {
+			return true
+		}
+	}
+
+	for _, clause := range t.objects {
+		levels := 0
+		other := false
+		for _, tag := range clause {
+			if tag.Negated {
+				continue
+			}
+			if hierarchy.exclusive(tag.Key) {
+				levels++
+			} else {
+				other = true
+			}
+		}
+		if !other && levels <= 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// protocolPortsCover returns true if every protocol port of b is contained by one of a
+func protocolPortsCover(a, b []*prisma.ProtocolPort) bool {
+
+	for _, y := range b {
+		found := false
+		for _, x := range a {
+			if x.Contains(y) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rulesetKey identifies a ruleset of a tree. Rulesets in different files of a namespace may
+// have the same name so the label of the file is part of the key.
+type rulesetKey struct {
+	namespace, label, name string
+}
+
+// allRulesets returns the rulesets of this namespace and below by rulesetKey
+func (t *Namespace) allRulesets() map[rulesetKey]*scopedRuleset {
+
+	result := make(map[rulesetKey]*scopedRuleset)
+
+	var walk func(ns *Namespace)
+	walk = func(ns *Namespace) {
+		for _, x := range ns.rulesets() {
+			result[rulesetKey{namespace: ns.rpath, label: x.file.label, name: x.ruleset.Name}] = x
+		}
+		for _, child := range ns.childMap {
+			walk(child)
+		}
+	}
+
+	walk(t)
+
+	return result
+}
+
+// SemanticDiff returns the semantic changes of the rulesets from the old tree to the new tree.
+// The old tree is from and the new tree is to.
+// Rulesets are matched by namespace, file label and name. Rules are matched first by direction, action and
+// objects, then by direction and objects, then by direction, action and protocol ports; rules
+// that do not match are added or removed. The result is sorted by namespace, policy and risk.
+func SemanticDiff(from, to *Namespace) []*Change {
+
+	hierarchy := to.hierarchy
+	exclusive := hierarchy.exclusive
+
+	oldRulesets := from.allRulesets()
+	newRulesets := to.allRulesets()
+
+	var changes []*Change
+
+	for key, x := range newRulesets {
+
+		add := func(direction string, kind ChangeKind, risk Risk, format string, args ...interface{}) {
+			changes = append(changes, &Change{
+				Namespace: x.namespace.rpath,
+				Path:      x.file.path,
+				Policy:    x.ruleset.Name,
+				Direction: direction,
+				Kind:      kind,
+				Risk:      risk,
+				Message:   fmt.Sprintf("policy %s in namespace %s ", x.ruleset.Name, x.namespace.rpath) + fmt.Sprintf(format, args...),
+			})
+		}
+
+		y, ok := oldRulesets[key]
+		if !ok {
+			add("", ChangePolicyAdded, RiskLow, "was added")
+			y = &scopedRuleset{ruleset: &prisma.Networkrulesetpolicy{Subject: x.ruleset.Subject, Propagate: x.ruleset.Propagate}, namespace: x.namespace}
+		}
+
+		if x.ruleset.Propagate && !y.ruleset.Propagate {
+			add("", ChangePropagationEnabled, RiskMedium, "now propagates to the namespaces below")
+		} else if !x.ruleset.Propagate && y.ruleset.Propagate {
+			add("", ChangePropagationDisabled, RiskLow, "no longer propagates to the namespaces below")
+		}
+
+		newSubject, err1 := prisma.ParseTagExpression(x.namespace.subjectTags(x.ruleset))
+		oldSubject, err2 := prisma.ParseTagExpression(y.namespace.subjectTags(y.ruleset))
+		if err1 == nil && err2 == nil {
+			broader := newSubject.Subsumes(oldSubject, exclusive)
+			narrower := oldSubject.Subsumes(newSubject, exclusive)
+			switch {
+			case broader && !narrower:
+				add("", ChangeSubjectBroadened, RiskMedium, "subject broadened from %s to %s", oldSubject.String(), newSubject.String())
+			case narrower && !broader:
+				add("", ChangeSubjectNarrowed, RiskLow, "subject narrowed from %s to %s", oldSubject.String(), newSubject.String())
+			case !broader && !narrower:
+				add("", ChangeSubjectChanged, RiskMedium, "subject changed from %s to %s", oldSubject.String(), newSubject.String())
+			}
+		}
+
+		compare := func(direction string, newRules, oldRules []*prisma.Rule) {
+
+			var news, olds []*semanticRule
+			for _, r := range newRules {
+				if r != nil {
+					news = append(news, newSemanticRule(r))
+				}
+			}
+			for _, r := range oldRules {
+				if r != nil {
+					olds = append(olds, newSemanticRule(r))
+				}
+			}
+
+			find := func(n *semanticRule, match func(o *semanticRule) bool) *semanticRule {
+				for _, o := range olds {
+					if !o.matched && match(o) {
+						o.matched = true
+						n.matched = true
+						return o
+					}
+				}
+				return nil
+			}
+
+			// Unchanged rules and rules whose protocol ports changed
+			for _, n := range news {
+				o := find(n, func(o *semanticRule) bool {
+					return o.rule.Action == n.rule.Action && o.objectsKey == n.objectsKey
+				})
+				if o == nil || o.portsKey == n.portsKey {
+					continue
+				}
+				wider := protocolPortsCover(n.protocolPorts, o.protocolPorts)
+				narrower := protocolPortsCover(o.protocolPorts, n.protocolPorts)
+				allow := n.rule.Action == prisma.TrafficActionAllow
+				switch {
+				case wider && !narrower:
+					risk := RiskLow
+					if allow {
+						risk = RiskMedium
+						if n.broad(hierarchy) {
+							risk = RiskHigh
+						}
+					}
+					add(direction, ChangePortsWidened, risk, "%s rule widened from %s to %s", direction, o.describe(direction), n.describe(direction))
+				case narrower && !wider:
+					risk := RiskLow
+					if !allow {
+						risk = RiskMedium
+					}
+					add(direction, ChangePortsNarrowed, risk, "%s rule narrowed from %s to %s", direction, o.describe(direction), n.describe(direction))
+				default:
+					add(direction, ChangePortsChanged, RiskMedium, "%s rule changed from %s to %s", direction, o.describe(direction), n.describe(direction))
+				}
+			}
+
+			// Rules whose action flipped
+			for _, n := range news {
+				if n.matched {
+					continue
+				}
+				o := find(n, func(o *semanticRule) bool {
+					return o.objectsKey == n.objectsKey && o.portsKey == n.portsKey
+				})
+				if o == nil {
+					continue
+				}
+				if n.rule.Action == prisma.TrafficActionAllow {
+					add(direction, ChangeActionAllowed, RiskHigh, "%s rule flipped from %s to %s", direction, o.describe(direction), n.describe(direction))
+				} else {
+					add(direction, ChangeActionRejected, RiskLow, "%s rule flipped from %s to %s", direction, o.describe(direction), n.describe(direction))
+				}
+			}
+
+			// Rules whose objects changed
+			for _, n := range news {
+				if n.matched {
+					continue
+				}
+				o := find(n, func(o *semanticRule) bool {
+					return o.rule.Action == n.rule.Action && o.portsKey == n.portsKey
+				})
+				if o == nil {
+					continue
+				}
+				broader := n.objects.Subsumes(o.objects, exclusive)
+				narrower := o.objects.Subsumes(n.objects, exclusive)
+				allow := n.rule.Action == prisma.TrafficActionAllow
+				switch {
+				case broader && !narrower:
+					risk := RiskLow
+					if allow {
+						risk = RiskMedium
+						if n.broad(hierarchy) {
+							risk = RiskHigh
+						}
+					}
+					add(direction, ChangeObjectsBroadened, risk, "%s rule broadened from %s to %s", direction, o.describe(direction), n.describe(direction))
+				case narrower && !broader:
+					risk := RiskLow
+					if !allow {
+						risk = RiskMedium
+					}
+					add(direction, ChangeObjectsNarrowed, risk, "%s rule narrowed from %s to %s", direction, o.describe(direction), n.describe(direction))
+				default:
+					add(direction, ChangeObjectsChanged, RiskMedium, "%s rule changed from %s to %s", direction, o.describe(direction), n.describe(direction))
+				}
+			}
+
+			for _, n := range news {
+				if n.matched {
+					continue
+				}
+				risk := RiskLow
+				if n.rule.Action == prisma.TrafficActionAllow {
+					risk = RiskMedium
+					if n.broad(hierarchy) {
+						risk = RiskHigh
+					}
+				}
+				add(direction, ChangeRuleAdded, risk, "%s rule added: %s", direction, n.describe(direction))
+			}
+
+			for _, o := range olds {
+				if o.matched {
+					continue
+				}
+				risk := RiskLow
+				if o.rule.Action == prisma.TrafficActionReject {
+					risk = RiskHigh
+				}
+				add(direction, ChangeRuleRemoved, risk, "%s rule removed: %s", direction, o.describe(direction))
+			}
+		}
+
+		compare("OutgoingRules", x.ruleset.OutgoingRules, y.ruleset.OutgoingRules)
+		compare("IncomingRules", x.ruleset.IncomingRules, y.ruleset.IncomingRules)
+	}
+
+	for key, y := range oldRulesets {
+
+		if _, ok := newRulesets[key]; ok {
+			continue
+		}
+
+		add := func(direction string, kind ChangeKind, risk Risk, format string, args ...interface{}) {
+			changes = append(changes, &Change{
+				Namespace: y.namespace.rpath,
+				Path:      y.file.path,
+				Policy:    y.ruleset.Name,
+				Direction: direction,
+				Kind:      kind,
+				Risk:      risk,
+				Message:   fmt.Sprintf("policy %s in namespace %s ", y.ruleset.Name, y.namespace.rpath) + fmt.Sprintf(format, args...),
+			})
+		}
+
+		add("", ChangePolicyRemoved, RiskLow, "was removed")
+
+		for _, direction := range []string{"OutgoingRules", "IncomingRules"} {
+			rules := y.ruleset.IncomingRules
+			if direction == "OutgoingRules" {
+				rules = y.ruleset.OutgoingRules
+			}
+			for _, r := range rules {
+				if r == nil {
+					continue
+				}
+				o := newSemanticRule(r)
+				risk := RiskLow
+				if r.Action == prisma.TrafficActionReject {
+					risk = RiskHigh
+				}
+				add(direction, ChangeRuleRemoved, risk, "%s rule removed: %s", direction, o.describe(direction))
+			}
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Policy != b.Policy {
+			return a.Policy < b.Policy
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Risk != b.Risk {
+			return a.Risk.rank() > b.Risk.rank()
+		}
+		return a.Message < b.Message
+	})
+
+	return changes
+}
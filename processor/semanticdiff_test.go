@@ -0,0 +1,245 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// policyTree writes the files, by path relative to the root, to a new directory and returns
+// the loaded tree
+func policyTree(t *testing.T, files map[string]string) *Namespace {
+
+	root := t.TempDir()
+
+	for path, content := range files {
+
+		path = filepath.Join(root, filepath.FromSlash(path))
+
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	namespace, err := NewNamespace(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return namespace
+}
+
+// rulesetYAML returns a ruleset with the subject and the incoming rules, each written
+// as a YAML flow mapping
+func rulesetYAML(name string, propagate bool, subject string, rules ...string) string {
+
+	s := fmt.Sprintf("        - name: %s\n          propagate: %t\n          subject: [[%s]]\n", name, propagate, subject)
+
+	if len(rules) > 0 {
+		s += "          incomingRules:\n"
+		for _, x := range rules {
+			s += "            - " + x + "\n"
+		}
+	}
+
+	return s
+}
+
+// policyYAML returns a config file holding the rulesets
+func policyYAML(rulesets ...string) string {
+	return "data:\n    networkrulesetpolicies:\n" + strings.Join(rulesets, "")
+}
+
+// changeKinds returns the kind and risk of each change sorted
+func changeKinds(changes []*Change) []string {
+
+	var result []string
+
+	for _, x := range changes {
+		result = append(result, fmt.Sprintf("%s/%s", x.Kind, x.Risk))
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+func TestSemanticDiffRisk(t *testing.T) {
+
+	const (
+		allow22     = "{action: Allow, object: [[app=web]], protocolPorts: [tcp/22]}"
+		reject22    = "{action: Reject, object: [[app=web]], protocolPorts: [tcp/22]}"
+		allow22443  = "{action: Allow, object: [[app=web]], protocolPorts: [tcp/22, tcp/443]}"
+		reject22443 = "{action: Reject, object: [[app=web]], protocolPorts: [tcp/22, tcp/443]}"
+	)
+
+	tests := []struct {
+		name     string
+		old, new []string
+		want     []string
+	}{
+		{"unchanged", []string{allow22}, []string{allow22}, nil},
+		{"allow added", nil, []string{allow22}, []string{"rule-added/medium"}},
+		{"allow added on any port", nil, []string{"{action: Allow, object: [[app=web]]}"}, []string{"rule-added/high"}},
+		{"allow added from a whole tenant", nil, []string{"{action: Allow, object: [['@org:tenant=t1']], protocolPorts: [tcp/22]}"}, []string{"rule-added/high"}},
+		{"reject added", nil, []string{reject22}, []string{"rule-added/low"}},
+		{"allow removed", []string{allow22}, nil, []string{"rule-removed/low"}},
+		{"reject removed", []string{reject22}, nil, []string{"rule-removed/high"}},
+		{"allow ports widened", []string{allow22}, []string{allow22443}, []string{"ports-widened/medium"}},
+		{"allow ports widened to every port", []string{allow22}, []string{"{action: Allow, object: [[app=web]], protocolPorts: [tcp]}"}, []string{"ports-widened/high"}},
+		{"reject ports widened", []string{reject22}, []string{reject22443}, []string{"ports-widened/low"}},
+		{"allow ports narrowed", []string{allow22443}, []string{allow22}, []string{"ports-narrowed/low"}},
+		{"reject ports narrowed", []string{reject22443}, []string{reject22}, []string{"ports-narrowed/medium"}},
+		{"ports changed", []string{allow22}, []string{"{action: Allow, object: [[app=web]], protocolPorts: [tcp/23]}"}, []string{"ports-changed/medium"}},
+		{"reject flipped to allow", []string{reject22}, []string{allow22}, []string{"action-allowed/high"}},
+		{"allow flipped to reject", []string{allow22}, []string{reject22}, []string{"action-rejected/low"}},
+		{"allow objects broadened", []string{allow22}, []string{"{action: Allow, object: [[app=*]], protocolPorts: [tcp/22]}"}, []string{"objects-broadened/medium"}},
+		{"allow objects broadened to a whole tenant", []string{"{action: Allow, object: [['@org:tenant=t1', app=web]], protocolPorts: [tcp/22]}"}, []string{"{action: Allow, object: [['@org:tenant=t1']], protocolPorts: [tcp/22]}"}, []string{"objects-broadened/high"}},
+		{"allow objects narrowed", []string{"{action: Allow, object: [[app=*]], protocolPorts: [tcp/22]}"}, []string{allow22}, []string{"objects-narrowed/low"}},
+		{"reject objects narrowed", []string{"{action: Reject, object: [[app=*]], protocolPorts: [tcp/22]}"}, []string{reject22}, []string{"objects-narrowed/medium"}},
+		{"objects changed", []string{allow22}, []string{"{action: Allow, object: [[app=api]], protocolPorts: [tcp/22]}"}, []string{"objects-changed/medium"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			from := policyTree(t, map[string]string{"t1/c1/policy0.yaml": policyYAML(rulesetYAML("ruleset1", false, "app=db", test.old...))})
+			to := policyTree(t, map[string]string{"t1/c1/policy0.yaml": policyYAML(rulesetYAML("ruleset1", false, "app=db", test.new...))})
+
+			got := changeKinds(SemanticDiff(from, to))
+
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSemanticDiffRuleset(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		old, new string
+		want     []string
+	}{
+		{
+			name: "propagation enabled",
+			old:  rulesetYAML("ruleset1", false, "app=db"),
+			new:  rulesetYAML("ruleset1", true, "app=db"),
+			want: []string{"propagation-enabled/medium"},
+		},
+		{
+			name: "propagation disabled",
+			old:  rulesetYAML("ruleset1", true, "app=db"),
+			new:  rulesetYAML("ruleset1", false, "app=db"),
+			want: []string{"propagation-disabled/low"},
+		},
+		{
+			name: "subject broadened",
+			old:  rulesetYAML("ruleset1", false, "app=db"),
+			new:  rulesetYAML("ruleset1", false, "app=*"),
+			want: []string{"subject-broadened/medium"},
+		},
+		{
+			name: "subject narrowed",
+			old:  rulesetYAML("ruleset1", false, "app=*"),
+			new:  rulesetYAML("ruleset1", false, "app=db"),
+			want: []string{"subject-narrowed/low"},
+		},
+		{
+			name: "policy added",
+			old:  rulesetYAML("ruleset1", false, "app=db"),
+			new:  rulesetYAML("ruleset1", false, "app=db") + rulesetYAML("ruleset2", false, "app=db", "{action: Allow, object: [[app=web]], protocolPorts: [tcp/22]}"),
+			want: []string{"policy-added/low", "rule-added/medium"},
+		},
+		{
+			name: "policy removed",
+			old:  rulesetYAML("ruleset1", false, "app=db") + rulesetYAML("ruleset2", false, "app=db", "{action: Reject, object: [[app=web]], protocolPorts: [tcp/22]}"),
+			new:  rulesetYAML("ruleset1", false, "app=db"),
+			want: []string{"policy-removed/low", "rule-removed/high"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			from := policyTree(t, map[string]string{"t1/c1/policy0.yaml": policyYAML(test.old)})
+			to := policyTree(t, map[string]string{"t1/c1/policy0.yaml": policyYAML(test.new)})
+
+			got := changeKinds(SemanticDiff(from, to))
+
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSemanticDiffRuleMatching(t *testing.T) {
+
+	// Each new rule is matched to the old rule it changed regardless of the order of the rules
+	from := policyTree(t, map[string]string{"t1/c1/policy0.yaml": policyYAML(rulesetYAML("ruleset1", false, "app=db",
+		"{action: Allow, object: [[app=a]], protocolPorts: [tcp/22]}",
+		"{action: Allow, object: [[app=b]], protocolPorts: [tcp/80]}",
+		"{action: Allow, object: [[app=c]], protocolPorts: [tcp/443]}",
+		"{action: Reject, object: [[app=e]], protocolPorts: [udp/53]}",
+	))})
+
+	to := policyTree(t, map[string]string{"t1/c1/policy0.yaml": policyYAML(rulesetYAML("ruleset1", false, "app=db",
+		"{action: Reject, object: [[app=e]], protocolPorts: [udp/53]}",
+		"{action: Allow, object: [[app=d]], protocolPorts: [tcp/443]}",
+		"{action: Reject, object: [[app=b]], protocolPorts: [tcp/80]}",
+		"{action: Allow, object: [[app=a]], protocolPorts: [tcp/22, tcp/23]}",
+	))})
+
+	got := changeKinds(SemanticDiff(from, to))
+	want := []string{"action-rejected/low", "objects-changed/medium", "ports-widened/medium"}
+
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSemanticDiffSameNameInTwoFiles(t *testing.T) {
+
+	// Both files define ruleset1; a change in the first file must not be hidden by the second
+	files := func(action string) map[string]string {
+		return map[string]string{
+			"t1/c1/policy0.yaml": policyYAML(rulesetYAML("ruleset1", false, "app=db", "{action: "+action+", object: [[app=web]], protocolPorts: [tcp/22]}")),
+			"t1/c1/policy1.yaml": policyYAML(rulesetYAML("ruleset1", false, "app=db", "{action: Allow, object: [[app=api]], protocolPorts: [tcp/80]}")),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		old, new string
+		want     []string
+	}{
+		{"allow flipped to reject", "Allow", "Reject", []string{"action-rejected/low"}},
+		{"reject flipped to allow", "Reject", "Allow", []string{"action-allowed/high"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			changes := SemanticDiff(policyTree(t, files(test.old)), policyTree(t, files(test.new)))
+
+			got := changeKinds(changes)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Fatalf("expected %v, got %v", test.want, got)
+			}
+
+			if filepath.Base(changes[0].Path) != "policy0.yaml" {
+				t.Errorf("expected the change in policy0.yaml, got %s", changes[0].Path)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+)
+
+const (
+	// RuleIDRuleDuplicate is reported when a rule is an exact duplicate of an earlier rule in
+	// the same ruleset and direction
+	RuleIDRuleDuplicate RuleID = "rule-duplicate"
+	// RuleIDRuleRedundant is reported when a rule is entirely covered by an earlier rule with the
+	// same action
+	RuleIDRuleRedundant RuleID = "rule-redundant"
+	// RuleIDRuleShadowed is reported when an Allow rule is entirely covered by a Reject rule and
+	// so can never take effect
+	RuleIDRuleShadowed RuleID = "rule-shadowed"
+)
+
+// ruleConflict is a rule that can never take effect because of another rule in the same list
+type ruleConflict struct {
+	ruleID RuleID
+	index  int // the index of the rule that can never take effect
+	other  int // the index of the rule that covers it
+}
+
+// parsedRule is a rule with its parsed objects and protocol ports
+type parsedRule struct {
+	rule          *prisma.Rule
+	objects       prisma.TagExpression
+	protocolPorts []*prisma.ProtocolPort
+}
+
+// covers returns true if all of the traffic matched by other is also matched by t. The
+// objects of t must subsume the objects of other and each protocol port of other must be
+// contained by a protocol port of t.
+func (t *parsedRule) covers(other *parsedRule, exclusive func(key string) bool) bool {
+
+	if !t.objects.Subsumes(other.objects, exclusive) {
+		return false
+	}
+
+	for _, protocolPort := range other.protocolPorts {
+		found := false
+		for _, x := range t.protocolPorts {
+			if x.Contains(protocolPort) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ruleConflicts compares each pair of rules and returns the rules that can never take effect.
+// A rule that covers a later rule with the same action makes the later rule redundant, or a
+// duplicate if they cover each other. Reject takes precedence over Allow so an Allow rule
+// covered by any Reject rule is shadowed. Rules without objects and rules with invalid tags
+// or protocol ports are skipped; these are reported elsewhere. Each rule is reported at most
+// once. Keys for which exclusive returns true can only have one value.
+func ruleConflicts(rules []*prisma.Rule, exclusive func(key string) bool) []*ruleConflict {
+
+	parsed := make([]*parsedRule, len(rules))
+
+	for i, rule := range rules {
+		if rule == nil || len(rule.Object) == 0 {
+			continue
+		}
+		objects, err := prisma.ParseTagExpression(rule.Object)
+		if err != nil {
+			continue
+		}
+		protocolPorts, err := rule.ParsedProtocolPorts()
+		if err != nil {
+			continue
+		}
+		parsed[i] = &parsedRule{rule: rule, objects: objects, protocolPorts: protocolPorts}
+	}
+
+	var result []*ruleConflict
+
+	for i, x := range parsed {
+
+		if x == nil {
+			continue
+		}
+
+		for j, other := range parsed {
+
+			if j == i || other == nil || !other.covers(x, exclusive) {
+				continue
+			}
+
+			var ruleID RuleID
+
+			switch {
+
+			case other.rule.Action == prisma.TrafficActionReject && x.rule.Action == prisma.TrafficActionAllow:
+				ruleID = RuleIDRuleShadowed
+
+			case j > i || other.rule.Action != x.rule.Action:
+				continue
+
+			case x.covers(other, exclusive):
+				ruleID = RuleIDRuleDuplicate
+
+			default:
+				ruleID = RuleIDRuleRedundant
+			}
+
+			result = append(result, &ruleConflict{ruleID: ruleID, index: i, other: j})
+			break
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintIgnoreAnnotation is the annotation key used to suppress findings for a policy. Each
+// value is a rule ID followed by a colon and a justification. The justification is required
+// so that every suppression can be audited.
+//
+// Example:
+//
+//	annotations:
+//	  lint-ignore:
+//	    - "namespace-not-found: cross tenant access approved in SEC-123"
+const LintIgnoreAnnotation = "lint-ignore"
+
+// RuleIDSuppressionInvalid is reported when a suppression can not be parsed or does not have
+// a justification
+const RuleIDSuppressionInvalid RuleID = "suppression-invalid"
+
+// suppression is a single parsed entry of the LintIgnoreAnnotation
+type suppression struct {
+	ruleID        RuleID
+	justification string
+}
+
+// annotationValues returns the values of the annotation key. Annotations are not typed in the
+// prisma package so both a list of strings and a single string are accepted.
+func annotationValues(annotations interface{}, key string) []string {
+
+	var value interface{}
+
+	switch x := annotations.(type) {
+
+	case map[string]interface{}:
+		value = x[key]
+
+	case map[string][]string:
+		return x[key]
+
+	default:
+		return nil
+	}
+
+	switch x := value.(type) {
+
+	case string:
+		return []string{x}
+
+	case []string:
+		return x
+
+	case []interface{}:
+		var result []string
+		for _, y := range x {
+			if s, ok := y.(string); ok {
+				result = append(result, s)
+			} else {
+				result = append(result, fmt.Sprint(y))
+			}
+		}
+		return result
+	}
+
+	return nil
+}
+
+// parseSuppression parses a LintIgnoreAnnotation value of the form "rule-id: justification"
+func parseSuppression(s string) (*suppression, error) {
+
+	split := strings.SplitN(s, ":", 2)
+
+	ruleID := strings.TrimSpace(split[0])
+	if ruleID == "" {
+		return nil, fmt.Errorf("suppression \"%s\" does not have a rule ID", s)
+	}
+
+	if len(split) < 2 || strings.TrimSpace(split[1]) == "" {
+		return nil, fmt.Errorf("suppression of %s does not have a justification", ruleID)
+	}
+
+	return &suppression{
+		ruleID:        RuleID(ruleID),
+		justification: strings.TrimSpace(split[1]),
+	}, nil
+}
+
+// suppress marks the findings that are suppressed by the LintIgnoreAnnotation in annotations.
+// The path is the path of the annotations in the YAML document and is used to report invalid
+// suppressions. The findings for invalid suppressions are returned.
+func (t *file) suppress(findings Findings, annotations interface{}, policy string, path []interface{}) Findings {
+
+	var invalid Findings
+
+	suppressions := make(map[RuleID]string)
+
+	for i, value := range annotationValues(annotations, LintIgnoreAnnotation) {
+
+		x, err := parseSuppression(value)
+		if err != nil {
+			finding := t.newFinding(RuleIDSuppressionInvalid, "%s in policy %s in file \"%s\"", err.Error(), policy, t.path)
+			finding.Policy = policy
+			t.setPosition(finding, append(append([]interface{}{}, path...), LintIgnoreAnnotation, i)...)
+			invalid = append(invalid, finding)
+			continue
+		}
+
+		suppressions[x.ruleID] = x.justification
+	}
+
+	for _, x := range findings {
+		if justification, ok := suppressions[x.RuleID]; ok {
+			x.Suppressed = true
+			x.Justification = justification
+		}
+	}
+
+	return invalid
+}
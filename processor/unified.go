@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unifiedContext is the number of unchanged lines shown around each change
+const unifiedContext = 3
+
+// diffOp is a single line of a line based diff
+type diffOp struct {
+	kind byte // ' ' for unchanged, '-' for removed and '+' for added
+	line string
+}
+
+// splitLines splits s into lines keeping the final line if it is not terminated
+func splitLines(s string) []string {
+
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// diffLines returns the operations that transform a into b using the longest common
+// subsequence of lines. Policy files are small so the quadratic table is acceptable.
+func diffLines(a, b []string) []diffOp {
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+
+	return ops
+}
+
+// unifiedDiff returns the unified diff between original and modified. The names are used in
+// the header. If there are no differences an empty string is returned.
+func unifiedDiff(originalName, modifiedName, original, modified string) string {
+
+	ops := diffLines(splitLines(original), splitLines(modified))
+
+	var sb strings.Builder
+
+	// Walk the operations grouping changes that are within twice the context of each other
+	// into hunks
+	for start := 0; start < len(ops); {
+
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		first := start - unifiedContext
+		if first < 0 {
+			first = 0
+		}
+
+		last := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			} else if k-last > 2*unifiedContext {
+				break
+			}
+		}
+
+		end := last + unifiedContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		// Line numbers are counted up to the start of the hunk
+		aLine, bLine := 1, 1
+		for _, op := range ops[:first] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+
+		aCount, bCount := 0, 0
+		for _, op := range ops[first:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", originalName, modifiedName)
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+
+		for _, op := range ops[first:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = end
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats the start and count of a hunk as used in the hunk header
+func hunkRange(start, count int) string {
+
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns n lines named line1 to lineN each terminated by a newline
+func numberedLines(n int) []string {
+
+	var lines []string
+
+	for i := 1; i <= n; i++ {
+		lines = append(lines, fmt.Sprintf("line%d\n", i))
+	}
+
+	return lines
+}
+
+// replaceLines returns a copy of lines with the 1 based line numbers replaced
+func replaceLines(lines []string, numbers ...int) []string {
+
+	result := append([]string{}, lines...)
+
+	for _, x := range numbers {
+		result[x-1] = fmt.Sprintf("changed%d\n", x)
+	}
+
+	return result
+}
+
+func TestUnifiedDiff(t *testing.T) {
+
+	lines := numberedLines(20)
+	original := strings.Join(lines, "")
+
+	tests := []struct {
+		name               string
+		original, modified string
+		want               string
+	}{
+		{
+			name:     "identical",
+			original: original,
+			modified: original,
+			want:     "",
+		},
+		{
+			name:     "single change",
+			original: original,
+			modified: strings.Join(replaceLines(lines, 5), ""),
+			want: "--- a\n+++ b\n" +
+				"@@ -2,7 +2,7 @@\n" +
+				" line2\n line3\n line4\n-line5\n+changed5\n line6\n line7\n line8\n",
+		},
+		{
+			name:     "change at start",
+			original: original,
+			modified: strings.Join(replaceLines(lines, 1), ""),
+			want: "--- a\n+++ b\n" +
+				"@@ -1,4 +1,4 @@\n" +
+				"-line1\n+changed1\n line2\n line3\n line4\n",
+		},
+		{
+			name:     "changes within twice the context share a hunk",
+			original: original,
+			modified: strings.Join(replaceLines(lines, 5, 12), ""),
+			want: "--- a\n+++ b\n" +
+				"@@ -2,14 +2,14 @@\n" +
+				" line2\n line3\n line4\n-line5\n+changed5\n" +
+				" line6\n line7\n line8\n line9\n line10\n line11\n" +
+				"-line12\n+changed12\n line13\n line14\n line15\n",
+		},
+		{
+			name:     "changes further apart are split into hunks",
+			original: original,
+			modified: strings.Join(replaceLines(lines, 5, 13), ""),
+			want: "--- a\n+++ b\n" +
+				"@@ -2,7 +2,7 @@\n" +
+				" line2\n line3\n line4\n-line5\n+changed5\n line6\n line7\n line8\n" +
+				"@@ -10,7 +10,7 @@\n" +
+				" line10\n line11\n line12\n-line13\n+changed13\n line14\n line15\n line16\n",
+		},
+		{
+			name:     "insertion",
+			original: "a\nb\n",
+			modified: "a\nx\nb\n",
+			want:     "--- a\n+++ b\n@@ -1,2 +1,3 @@\n a\n+x\n b\n",
+		},
+		{
+			name:     "from empty",
+			original: "",
+			modified: "a\nb\n",
+			want:     "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:     "to empty",
+			original: "a\n",
+			modified: "",
+			want:     "--- a\n+++ b\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name:     "no newline at end of file",
+			original: "a\nb",
+			modified: "a\nc",
+			want:     "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := unifiedDiff("a", "b", test.original, test.modified); got != test.want {
+				t.Errorf("expected\n%s\ngot\n%s", test.want, got)
+			}
+		})
+	}
+}
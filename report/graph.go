@@ -0,0 +1,183 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jodydadescott/prisma-microseg-linter/prisma"
+	"github.com/jodydadescott/prisma-microseg-linter/processor"
+)
+
+// graph is the set of nodes, grouped by namespace, and edges built from flows. Nodes are
+// identified by their sorted tags and edges that are identical are only included once.
+type graph struct {
+	nodes      map[string]string   // tags to node ID
+	labels     map[string][]string // node ID to tags
+	namespaces map[string][]string // namespace to node IDs
+	edges      []*graphEdge
+}
+
+type graphEdge struct {
+	from, to, label string
+	reject          bool
+}
+
+func newGraph(flows []*processor.Flow) *graph {
+
+	t := &graph{
+		nodes:      make(map[string]string),
+		labels:     make(map[string][]string),
+		namespaces: make(map[string][]string),
+	}
+
+	node := func(x *processor.FlowEndpoint) string {
+		tags := append([]string{}, x.Tags...)
+		sort.Strings(tags)
+		key := strings.Join(tags, "\n")
+		if id, ok := t.nodes[key]; ok {
+			return id
+		}
+		id := fmt.Sprintf("n%d", len(t.nodes))
+		t.nodes[key] = id
+		t.labels[id] = tags
+		t.namespaces[x.Namespace] = append(t.namespaces[x.Namespace], id)
+		return id
+	}
+
+	seen := make(map[graphEdge]bool)
+
+	for _, x := range flows {
+
+		label := strings.Join(x.ProtocolPorts, ", ")
+		if label == "" {
+			label = prisma.ProtocolAny
+		}
+
+		edge := graphEdge{
+			from:   node(x.From),
+			to:     node(x.To),
+			label:  label,
+			reject: x.Action == prisma.TrafficActionReject,
+		}
+
+		if !seen[edge] {
+			seen[edge] = true
+			t.edges = append(t.edges, &edge)
+		}
+	}
+
+	return t
+}
+
+// sortedNamespaces returns the namespaces in order. Nodes that are not in a namespace have an
+// empty namespace which is first.
+func (t *graph) sortedNamespaces() []string {
+	var result []string
+	for ns := range t.namespaces {
+		result = append(result, ns)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// WriteDOT writes the flows as a Graphviz DOT graph. Each namespace is a cluster of the
+// subject and object nodes that resolve to it. Allow rules are solid edges and Reject rules
+// are dashed red edges; edges are labeled with the protocol ports.
+func WriteDOT(w io.Writer, flows []*processor.Flow) error {
+
+	t := newGraph(flows)
+
+	quote := func(s string) string {
+		return "\"" + strings.ReplaceAll(strings.ReplaceAll(s, "\\", "\\\\"), "\"", "\\\"") + "\""
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("digraph flows {\n")
+	sb.WriteString("\trankdir=LR;\n")
+	sb.WriteString("\tnode [shape=box];\n")
+
+	for i, ns := range t.sortedNamespaces() {
+
+		indent := "\t"
+
+		if ns != "" {
+			fmt.Fprintf(&sb, "\tsubgraph cluster_%d {\n", i)
+			fmt.Fprintf(&sb, "\t\tlabel=%s;\n", quote(ns))
+			indent = "\t\t"
+		}
+
+		for _, id := range t.namespaces[ns] {
+			fmt.Fprintf(&sb, "%s%s [label=%s];\n", indent, id, strings.ReplaceAll(quote(strings.Join(t.labels[id], "\n")), "\n", "\\n"))
+		}
+
+		if ns != "" {
+			sb.WriteString("\t}\n")
+		}
+	}
+
+	for _, x := range t.edges {
+		if x.reject {
+			fmt.Fprintf(&sb, "\t%s -> %s [label=%s, style=dashed, color=red];\n", x.from, x.to, quote(x.label))
+		} else {
+			fmt.Fprintf(&sb, "\t%s -> %s [label=%s];\n", x.from, x.to, quote(x.label))
+		}
+	}
+
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteMermaid writes the flows as a Mermaid flowchart. See WriteDOT.
+func WriteMermaid(w io.Writer, flows []*processor.Flow) error {
+
+	t := newGraph(flows)
+
+	quote := func(s string) string {
+		return "\"" + strings.ReplaceAll(s, "\"", "#quot;") + "\""
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("flowchart LR\n")
+
+	for i, ns := range t.sortedNamespaces() {
+
+		indent := "    "
+
+		if ns != "" {
+			fmt.Fprintf(&sb, "    subgraph c%d[%s]\n", i, quote(ns))
+			indent = "        "
+		}
+
+		for _, id := range t.namespaces[ns] {
+			fmt.Fprintf(&sb, "%s%s[%s]\n", indent, id, quote(strings.Join(t.labels[id], "<br/>")))
+		}
+
+		if ns != "" {
+			sb.WriteString("    end\n")
+		}
+	}
+
+	var rejects []string
+
+	for i, x := range t.edges {
+		if x.reject {
+			fmt.Fprintf(&sb, "    %s -.->|%s| %s\n", x.from, quote(x.label), x.to)
+			rejects = append(rejects, fmt.Sprint(i))
+		} else {
+			fmt.Fprintf(&sb, "    %s -->|%s| %s\n", x.from, quote(x.label), x.to)
+		}
+	}
+
+	if len(rejects) > 0 {
+		fmt.Fprintf(&sb, "    linkStyle %s stroke:red\n", strings.Join(rejects, ","))
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,95 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jodydadescott/prisma-microseg-linter/processor"
+)
+
+// matrixHeader is the header row of the flow matrix
+var matrixHeader = []string{
+	"source namespace",
+	"source externalnetworks",
+	"source tags",
+	"destination namespace",
+	"destination externalnetworks",
+	"destination tags",
+	"direction",
+	"action",
+	"protocol ports",
+	"policy",
+	"file",
+}
+
+// WriteMatrix writes the flows as CSV with one row per flow. Tags, external networks and
+// protocol ports are sorted and joined with a space and the rows are sorted so that the output
+// is stable. File paths are relative to base. If excel is true cells that a spreadsheet would
+// interpret as a formula, such as tags starting with '@', are prefixed with a single quote.
+func WriteMatrix(w io.Writer, flows []*processor.Flow, base string, excel bool) error {
+
+	join := func(s []string) string {
+		x := append([]string{}, s...)
+		sort.Strings(x)
+		return strings.Join(x, " ")
+	}
+
+	var rows [][]string
+
+	for _, x := range flows {
+
+		path := x.Path
+		if rel, err := filepath.Rel(base, x.Path); err == nil {
+			path = filepath.ToSlash(rel)
+		}
+
+		rows = append(rows, []string{
+			x.From.Namespace,
+			join(x.From.Externalnetworks),
+			join(x.From.Tags),
+			x.To.Namespace,
+			join(x.To.Externalnetworks),
+			join(x.To.Tags),
+			x.Direction,
+			string(x.Action),
+			join(x.ProtocolPorts),
+			x.Policy,
+			path,
+		})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k := range rows[i] {
+			if rows[i][k] != rows[j][k] {
+				return rows[i][k] < rows[j][k]
+			}
+		}
+		return false
+	})
+
+	c := csv.NewWriter(w)
+
+	if err := c.Write(matrixHeader); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if excel {
+			for i, cell := range row {
+				if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+					row[i] = "'" + cell
+				}
+			}
+		}
+		if err := c.Write(row); err != nil {
+			return err
+		}
+	}
+
+	c.Flush()
+
+	return c.Error()
+}
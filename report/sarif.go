@@ -0,0 +1,208 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/jodydadescott/prisma-microseg-linter/processor"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolName     = "prisma-microseg-linter"
+	toolURI      = "https://github.com/jodydadescott/prisma-microseg-linter"
+)
+
+// The SARIF types below implement the subset of SARIF 2.1.0 that is needed to report
+// findings to code scanning tools.
+
+type sarifLog struct {
+	Version string      `json:"version"`
+	Schema  string      `json:"$schema"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    *sarifTool     `json:"tool"`
+	Results []*sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver *sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string                  `json:"id"`
+	ShortDescription     *sarifMessage           `json:"shortDescription"`
+	DefaultConfiguration *sarifRuleConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifRuleConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID       string                 `json:"ruleId"`
+	RuleIndex    int                    `json:"ruleIndex"`
+	Level        string                 `json:"level"`
+	Message      *sarifMessage          `json:"message"`
+	Locations    []*sarifLocation       `json:"locations,omitempty"`
+	Suppressions []*sarifSuppression    `json:"suppressions,omitempty"`
+	Properties   map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation *sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion           `json:"region,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifLevel converts a finding severity to a SARIF level
+func sarifLevel(severity processor.Severity) string {
+
+	switch severity {
+
+	case processor.SeverityError:
+		return "error"
+
+	case processor.SeverityWarning:
+		return "warning"
+
+	}
+
+	return "note"
+}
+
+// sarifURI converts a file path to a SARIF artifact URI. Relative paths are kept relative
+// so that code scanning tools can resolve them against the repository root.
+func sarifURI(path string) string {
+
+	path = filepath.ToSlash(filepath.Clean(path))
+
+	if strings.HasPrefix(path, "/") {
+		return "file://" + path
+	}
+
+	return path
+}
+
+// WriteSARIF writes the findings to w as a SARIF 2.1.0 log
+func WriteSARIF(w io.Writer, findings processor.Findings) error {
+
+	driver := &sarifDriver{
+		Name:           toolName,
+		InformationURI: toolURI,
+		Rules:          []*sarifRule{},
+	}
+
+	run := &sarifRun{
+		Tool:    &sarifTool{Driver: driver},
+		Results: []*sarifResult{},
+	}
+
+	ruleIndex := make(map[processor.RuleID]int)
+
+	for _, finding := range findings {
+
+		index, ok := ruleIndex[finding.RuleID]
+		if !ok {
+			index = len(driver.Rules)
+			ruleIndex[finding.RuleID] = index
+			driver.Rules = append(driver.Rules, &sarifRule{
+				ID:                   string(finding.RuleID),
+				ShortDescription:     &sarifMessage{Text: finding.RuleID.Description()},
+				DefaultConfiguration: &sarifRuleConfiguration{Level: sarifLevel(finding.RuleID.DefaultSeverity())},
+			})
+		}
+
+		properties := make(map[string]interface{})
+
+		if finding.Namespace != "" {
+			properties["namespace"] = finding.Namespace
+		}
+
+		if finding.Policy != "" {
+			properties["policy"] = finding.Policy
+		}
+
+		if finding.Direction != "" {
+			properties["direction"] = finding.Direction
+		}
+
+		if finding.Tag != "" {
+			properties["tag"] = finding.Tag
+		}
+
+		var region *sarifRegion
+		if finding.Line > 0 {
+			region = &sarifRegion{
+				StartLine:   finding.Line,
+				StartColumn: finding.Column,
+			}
+		}
+
+		var suppressions []*sarifSuppression
+		if finding.Suppressed {
+			suppressions = append(suppressions, &sarifSuppression{
+				Kind:          "inSource",
+				Justification: finding.Justification,
+			})
+		}
+
+		run.Results = append(run.Results, &sarifResult{
+			RuleID:    string(finding.RuleID),
+			RuleIndex: index,
+			Level:     sarifLevel(finding.Severity),
+			Message:   &sarifMessage{Text: finding.Message},
+			Locations: []*sarifLocation{
+				{
+					PhysicalLocation: &sarifPhysicalLocation{
+						ArtifactLocation: &sarifArtifactLocation{URI: sarifURI(finding.Path)},
+						Region:           region,
+					},
+				},
+			},
+			Suppressions: suppressions,
+			Properties:   properties,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(&sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []*sarifRun{run},
+	})
+}